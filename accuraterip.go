@@ -0,0 +1,120 @@
+// accuraterip.go - AccurateRip checksums of CD images.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// accurateRipSkip is the number of samples at the start of the first track
+// and the end of the last track that AccurateRip leaves out of its
+// checksums, since drives cannot all read them: 5 frames, less one sample at
+// the start.
+const accurateRipSkip = 5 * CDSamplesPerFrame
+
+// AccurateRipChecksum holds the AccurateRip checksums of a track.
+type AccurateRipChecksum struct {
+	Track uint8
+	V1    uint32
+	V2    uint32
+}
+
+// trackRanges returns the sample range of each track of the CD described by
+// the cue sheet, from its INDEX 01 to the next track's INDEX 01 or the
+// lead-out, as a CD ripper that appends gaps to the previous track splits
+// them.
+func (blk *CuesheetBlock) trackRanges() (starts []uint64, end uint64, err error) {
+	if _, _, err := blk.toc(); err != nil {
+		return nil, 0, err
+	}
+	for _, t := range blk.Tracks[:len(blk.Tracks)-1] {
+		for _, idx := range t.Indexes {
+			if idx.IndexPoint == 1 {
+				starts = append(starts, t.Offset+idx.SampleOffset)
+			}
+		}
+	}
+	return starts, blk.Tracks[len(blk.Tracks)-1].Offset, nil
+}
+
+// AccurateRip decodes the FLAC stream read from r, which must hold a CD
+// image with a CUESHEET, and returns the AccurateRip v1 and v2 checksums of
+// each track, for comparison with the AccurateRip database. The stream must
+// be 16 bit stereo audio at 44.1kHz.
+func AccurateRip(r io.Reader) ([]AccurateRipChecksum, error) {
+	m, d, err := Open(r)
+	if err != nil {
+		return nil, err
+	}
+	si := m.Streaminfo.Data
+	if si.SampleRate != 44100 || si.BitsPerSample != 16 || si.Channels != 2 {
+		return nil, fmt.Errorf("AccurateRip needs 16 bit stereo audio at 44.1kHz, stream has %d bit %d channel audio at %dHz",
+			si.BitsPerSample, si.Channels, si.SampleRate)
+	}
+	if !m.Cuesheet.IsPopulated {
+		return nil, fmt.Errorf("stream has no CUESHEET")
+	}
+	cs := m.Cuesheet.Data
+	starts, end, err := cs.trackRanges()
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make([]AccurateRipChecksum, len(starts))
+	for i := range sums {
+		sums[i].Track = cs.Tracks[i].Number
+	}
+	track := -1
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pos := frame.FirstSample
+		for i := 0; i+1 < len(frame.Samples); i, pos = i+2, pos+1 {
+			for track+1 < len(starts) && pos >= starts[track+1] {
+				track++
+			}
+			if track < 0 || pos >= end {
+				continue
+			}
+			n := pos - starts[track] + 1
+			if track == 0 && n < accurateRipSkip || track == len(starts)-1 && pos >= end-accurateRipSkip {
+				continue
+			}
+
+			sample := uint64(uint16(frame.Samples[i])) | uint64(uint16(frame.Samples[i+1]))<<16
+			product := sample * n
+			sums[track].V1 += uint32(product)
+			sums[track].V2 += uint32(product) + uint32(product>>32)
+		}
+	}
+	return sums, nil
+}
+
+// AccurateRipFile is like AccurateRip for the FLAC file at path.
+func AccurateRipFile(path string) ([]AccurateRipChecksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return AccurateRip(f)
+}
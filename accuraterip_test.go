@@ -0,0 +1,83 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// accurateRipReference computes the AccurateRip checksums of a track as
+// they are usually described: over the track's samples as 32 bit words,
+// each multiplied by its position in the track.
+func accurateRipReference(samples []int32, firstTrack, lastTrack bool) (v1, v2 uint32) {
+	n := len(samples) / 2
+	for i := 0; i < n; i++ {
+		mult := uint64(i + 1)
+		if firstTrack && mult < 5*588 || lastTrack && mult > uint64(n-5*588) {
+			continue
+		}
+		word := uint64(uint32(samples[2*i])&0xFFFF | uint32(samples[2*i+1])<<16)
+		v1 += uint32(word * mult)
+		v2 += uint32(word*mult) + uint32(word*mult>>32)
+	}
+	return v1, v2
+}
+
+func TestAccurateRip(t *testing.T) {
+	samples := testSignal(40*588, 2, 16)
+	cs := &CuesheetBlock{
+		LeadinSamples: 88200,
+		IsCompactDisc: true,
+		Tracks: []*CuesheetTrack{
+			{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 15 * 588, Number: 2, Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 2 * 588, IndexPoint: 1}}},
+			{Offset: 25 * 588, Number: 3, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 40 * 588, Number: 170},
+		},
+	}
+	m := &Metadata{Streaminfo: Streaminfo{Data: &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}}}
+	m.SetCuesheet(cs)
+	buf := new(bytes.Buffer)
+	enc, err := NewEncoder(buf, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := AccurateRip(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := []int{0, 17 * 588, 25 * 588, 40 * 588}
+	if len(got) != 3 {
+		t.Fatalf("got %d tracks, want 3", len(got))
+	}
+	for i, sum := range got {
+		v1, v2 := accurateRipReference(samples[2*bounds[i]:2*bounds[i+1]], i == 0, i == 2)
+		if sum.Track != uint8(i+1) || sum.V1 != v1 || sum.V2 != v2 {
+			t.Errorf("track %d: got %+v, want V1 %08x, V2 %08x", i+1, sum, v1, v2)
+		}
+	}
+}
+
+func TestAccurateRipErrors(t *testing.T) {
+	sums, err := AccurateRipFile("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 3 || sums[0].Track != 1 || sums[2].Track != 3 {
+		t.Errorf("got %+v", sums)
+	}
+
+	if _, err := AccurateRipFile("testdata/44100-16-mono.flac"); err == nil {
+		t.Error("AccurateRip accepted mono audio")
+	}
+	if _, err := AccurateRip(bytes.NewReader(noStreaminfo(t))); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("stream without STREAMINFO: got %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,160 @@
+// bits.go - Bit-level reading and writing of FLAC audio frames.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"io"
+	"math/bits"
+)
+
+// bitReader reads big-endian bit fields from a byte stream, keeping count of
+// the bytes consumed and their CRC-16.
+type bitReader struct {
+	r   io.ByteReader
+	n   int64  // Bytes consumed.
+	crc uint16 // CRC-16 of the bytes consumed since crc was last reset.
+	x   uint64 // Unconsumed bits of the bytes read, right-aligned.
+	nx  uint   // Number of bits in x.
+
+	keep bool   // Whether to keep the bytes consumed in raw.
+	raw  []byte // Bytes consumed since raw was last reset.
+}
+
+// ReadByte reads the next whole byte. The reader must be byte aligned.
+func (br *bitReader) ReadByte() (byte, error) {
+	c, err := br.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	br.n++
+	br.crc = br.crc<<8 ^ crc16Table[byte(br.crc>>8)^c]
+	if br.keep {
+		br.raw = append(br.raw, c)
+	}
+	return c, nil
+}
+
+// Read implements io.Reader for byte aligned reads.
+func (br *bitReader) Read(p []byte) (int, error) {
+	for i := range p {
+		c, err := br.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		p[i] = c
+	}
+	return len(p), nil
+}
+
+// bits reads an n bit unsigned value; n must be at most 56.
+func (br *bitReader) bits(n uint) (uint64, error) {
+	for br.nx < n {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		br.x = br.x<<8 | uint64(c)
+		br.nx += 8
+	}
+	br.nx -= n
+	v := br.x >> br.nx
+	br.x &= 1<<br.nx - 1
+	return v, nil
+}
+
+// signed reads an n bit two's complement value.
+func (br *bitReader) signed(n uint) (int64, error) {
+	v, err := br.bits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// unary reads a unary coded value: the number of 0 bits before the next 1.
+func (br *bitReader) unary() (uint64, error) {
+	var q uint64
+	for {
+		if br.nx == 0 {
+			c, err := br.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			br.x, br.nx = uint64(c), 8
+		}
+		if br.x == 0 {
+			q += uint64(br.nx)
+			br.nx = 0
+			continue
+		}
+		z := br.nx - uint(bits.Len64(br.x))
+		br.nx -= z + 1
+		br.x &= 1<<br.nx - 1
+		return q + uint64(z), nil
+	}
+}
+
+// align discards the rest of the current byte.
+func (br *bitReader) align() {
+	br.x, br.nx = 0, 0
+}
+
+// bitWriter appends big-endian bit fields to a byte slice.
+type bitWriter struct {
+	buf []byte
+	x   uint64 // Bits not yet appended to buf, right-aligned.
+	nx  uint   // Number of bits in x; always less than 8 between calls.
+}
+
+// bits writes the low n bits of v.
+func (bw *bitWriter) bits(v uint64, n uint) {
+	for n > 0 {
+		k := n
+		if k > 32 {
+			k = 32
+		}
+		n -= k
+		bw.x = bw.x<<k | v>>n&(1<<k-1)
+		bw.nx += k
+		for bw.nx >= 8 {
+			bw.nx -= 8
+			bw.buf = append(bw.buf, byte(bw.x>>bw.nx))
+		}
+	}
+}
+
+// signed writes v as an n bit two's complement value.
+func (bw *bitWriter) signed(v int64, n uint) {
+	bw.bits(uint64(v), n)
+}
+
+// unary writes q 0 bits followed by a 1 bit.
+func (bw *bitWriter) unary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		bw.bits(0, 32)
+	}
+	bw.bits(1, uint(q)+1)
+}
+
+// align pads the output with 0 bits to a byte boundary.
+func (bw *bitWriter) align() {
+	if bw.nx > 0 {
+		bw.bits(0, 8-bw.nx)
+	}
+}
+
+// reset discards everything written.
+func (bw *bitWriter) reset() {
+	bw.buf, bw.x, bw.nx = bw.buf[:0], 0, 0
+}
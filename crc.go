@@ -0,0 +1,72 @@
+// crc.go - CRC checksums used by FLAC frames.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+// http://flac.sourceforge.net/format.html#frame_header
+// The frame header ends with a CRC-8 (polynomial x^8 + x^2 + x^1 + x^0) of
+// the header, and the frame ends with a CRC-16 (polynomial x^16 + x^15 +
+// x^2 + x^0) of the whole frame. Both are initialized with 0.
+
+var (
+	crc8Table  = makeCRC8Table(0x07)
+	crc16Table = makeCRC16Table(0x8005)
+)
+
+func makeCRC8Table(poly uint8) *[256]uint8 {
+	t := new([256]uint8)
+	for i := range t {
+		crc := uint8(i)
+		for j := 0; j < 8; j++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}
+
+func makeCRC16Table(poly uint16) *[256]uint16 {
+	t := new([256]uint16)
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}
+
+// crc8 updates crc with the bytes of b.
+func crc8(crc uint8, b []byte) uint8 {
+	for _, v := range b {
+		crc = crc8Table[crc^v]
+	}
+	return crc
+}
+
+// crc16 updates crc with the bytes of b.
+func crc16(crc uint16, b []byte) uint16 {
+	for _, v := range b {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^v]
+	}
+	return crc
+}
@@ -0,0 +1,430 @@
+// cue.go - Conversion between CUESHEET blocks and .cue files.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CD audio is addressed in frames of 1/75 second: 588 samples at 44.1kHz.
+const (
+	CDFramesPerSecond = 75
+	CDSamplesPerFrame = 44100 / CDFramesPerSecond
+)
+
+// trimNUL strips the NUL padding from a fixed-length string field.
+func trimNUL(s string) string {
+	return strings.TrimRight(s, "\x00")
+}
+
+// msf formats a sample offset as MM:SS:FF, in minutes, seconds and 1/75
+// second frames at sampleRate.
+func msf(offset uint64, sampleRate uint32) string {
+	frames := offset * CDFramesPerSecond / uint64(sampleRate)
+	return fmt.Sprintf("%02d:%02d:%02d",
+		frames/(60*CDFramesPerSecond), frames/CDFramesPerSecond%60, frames%CDFramesPerSecond)
+}
+
+// WriteCue writes the cue sheet to w as a .cue file, in the layout of
+// metaflac --export-cuesheet-to. file names the audio file in the FILE
+// command; "dummy.wav" is used if it is empty. If IsCompactDisc is set, index
+// positions are given as MM:SS:FF, computed from the sample offsets and
+// si.SampleRate, and positions that do not fall on a 1/75 second frame are
+// rounded down; otherwise they are given as sample numbers. The lead-in and
+// the lead-out track, which .cue files have no command for, are written as
+// REM FLAC__lead-in and REM FLAC__lead-out comments. Data tracks are
+// written as DATA, and PRE is the only flag written, since a CUESHEET records
+// no others.
+func (blk *CuesheetBlock) WriteCue(w io.Writer, file string, si *StreaminfoBlock) error {
+	if len(blk.Tracks) == 0 {
+		return fmt.Errorf("cue sheet has no lead-out track")
+	}
+	if si.SampleRate == 0 {
+		return fmt.Errorf("invalid SampleRate '0'")
+	}
+	if file == "" {
+		file = "dummy.wav"
+	}
+
+	bw := bufio.NewWriter(w)
+	if mcn := trimNUL(blk.MediaCatalogNumber); mcn != "" {
+		fmt.Fprintf(bw, "CATALOG %s\n", mcn)
+	}
+	fmt.Fprintf(bw, "FILE \"%s\" WAVE\n", file)
+
+	tracks, leadout := blk.Tracks[:len(blk.Tracks)-1], blk.Tracks[len(blk.Tracks)-1]
+	for _, t := range tracks {
+		typ := "AUDIO"
+		if t.Type != 0 {
+			typ = "DATA"
+		}
+		fmt.Fprintf(bw, "  TRACK %02d %s\n", t.Number, typ)
+		if t.PreEmphasis {
+			fmt.Fprintf(bw, "    FLAGS PRE\n")
+		}
+		if isrc := trimNUL(t.ISRC); isrc != "" {
+			fmt.Fprintf(bw, "    ISRC %s\n", isrc)
+		}
+		for _, idx := range t.Indexes {
+			off := t.Offset + idx.SampleOffset
+			if blk.IsCompactDisc {
+				fmt.Fprintf(bw, "    INDEX %02d %s\n", idx.IndexPoint, msf(off, si.SampleRate))
+			} else {
+				fmt.Fprintf(bw, "    INDEX %02d %d\n", idx.IndexPoint, off)
+			}
+		}
+	}
+	fmt.Fprintf(bw, "REM FLAC__lead-in %d\n", blk.LeadinSamples)
+	fmt.Fprintf(bw, "REM FLAC__lead-out %d %d\n", leadout.Number, leadout.Offset)
+	return bw.Flush()
+}
+
+// isCDDA reports whether the stream in si can be CD-DA audio: 44.1kHz, 16
+// bits per sample and one or two channels.
+func isCDDA(si *StreaminfoBlock) bool {
+	return si.SampleRate == 44100 && si.BitsPerSample == 16 && (si.Channels == 1 || si.Channels == 2)
+}
+
+// cueFields splits a line of a .cue file into words; a double-quoted string
+// is a single word without its quotes.
+func cueFields(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] == '"' {
+			i := strings.IndexByte(line[1:], '"')
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			fields = append(fields, line[1:i+1])
+			line = line[i+2:]
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			i = len(line)
+		}
+		fields = append(fields, line[:i])
+		line = line[i:]
+	}
+}
+
+// cueFrames parses a MM:SS:FF position as a number of 1/75 second frames.
+func cueFrames(s string) (uint64, error) {
+	var mm, ss, ff uint64
+	var rest string
+	if n, _ := fmt.Sscanf(s, "%d:%d:%d%s", &mm, &ss, &ff, &rest); n != 3 || ss >= 60 || ff >= CDFramesPerSecond {
+		return 0, fmt.Errorf("invalid position %q; must be MM:SS:FF", s)
+	}
+	return (mm*60+ss)*CDFramesPerSecond + ff, nil
+}
+
+// cueSamples parses an INDEX or PREGAP position as a sample offset.
+// Positions are MM:SS:FF, or for non-CD-DA cue sheets also plain sample
+// numbers.
+func cueSamples(s string, si *StreaminfoBlock, cdda bool) (uint64, error) {
+	if !cdda && !strings.Contains(s, ":") {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid position %q", s)
+		}
+		return n, nil
+	}
+	frames, err := cueFrames(s)
+	if err != nil {
+		return 0, err
+	}
+	if cdda {
+		return frames * CDSamplesPerFrame, nil
+	}
+	return frames * uint64(si.SampleRate) / CDFramesPerSecond, nil
+}
+
+// isAlnum reports whether s holds only ASCII letters and digits.
+func isAlnum(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadCue parses a .cue file describing the audio stream si and returns it as
+// a CuesheetBlock, like metaflac --import-cuesheet-from. The cue sheet must
+// refer to a single FILE. IsCompactDisc is set if the stream can be CD-DA
+// audio, in which case positions must be MM:SS:FF, so that they fall on the
+// 588 sample CD frames, the lead-in defaults to 2 seconds and the lead-out is
+// track 170; otherwise positions may also be sample numbers and the lead-out
+// is track 255. The lead-out is placed at si.TotalSamples, or at the offset
+// given by a REM FLAC__lead-out comment if the total is unknown; like every
+// CD-DA position, it must fall on a 588 sample CD frame. A PREGAP on
+// the first track is added to the CD-DA lead-in; other tracks cannot have
+// one, since a CUESHEET can only describe audio that is in the stream. FLAGS other
+// than PRE, and commands that a CUESHEET has no field for, such as TITLE and
+// PERFORMER, are ignored.
+func ReadCue(r io.Reader, si *StreaminfoBlock) (*CuesheetBlock, error) {
+	if si.SampleRate == 0 {
+		return nil, fmt.Errorf("invalid SampleRate '0'")
+	}
+	cdda := isCDDA(si)
+	blk := &CuesheetBlock{IsCompactDisc: cdda}
+	if cdda {
+		blk.LeadinSamples = 2 * 44100
+	}
+
+	var (
+		track             *CuesheetTrack
+		files             int
+		leadout           uint64
+		haveLeadout       bool
+		pregap, haveStart bool
+	)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+		}
+		f, err := cueFields(s.Text())
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if len(f) == 0 {
+			continue
+		}
+		args := func(n int) error {
+			if len(f) < n+1 {
+				return errorf("%s needs %d arguments", f[0], n)
+			}
+			return nil
+		}
+
+		switch cmd := strings.ToUpper(f[0]); cmd {
+		case "CATALOG":
+			if err := args(1); err != nil {
+				return nil, err
+			}
+			if cdda && (len(f[1]) != 13 || strings.Trim(f[1], "0123456789") != "") {
+				return nil, errorf("CD-DA media catalog number %q must be 13 digits", f[1])
+			}
+			if len(f[1]) > CuesheetMediaCatalogNumberLen/8 {
+				return nil, errorf("media catalog number %q is longer than %d bytes", f[1], CuesheetMediaCatalogNumberLen/8)
+			}
+			blk.MediaCatalogNumber = f[1]
+
+		case "FILE":
+			if files++; files > 1 {
+				return nil, errorf("a CUESHEET can only describe a single FILE")
+			}
+
+		case "TRACK":
+			if err := args(2); err != nil {
+				return nil, err
+			}
+			if files == 0 {
+				return nil, errorf("TRACK before FILE")
+			}
+			n, err := strconv.ParseUint(f[1], 10, 8)
+			max := uint64(254)
+			if cdda {
+				max = 99
+			}
+			if err != nil || n == 0 || n > max {
+				return nil, errorf("invalid track number %q; must be 1-%d", f[1], max)
+			}
+			if track != nil && uint8(n) <= track.Number {
+				return nil, errorf("track %d follows track %d", n, track.Number)
+			}
+			if track != nil && len(track.Indexes) == 0 {
+				return nil, errorf("track %d has no INDEX 01", track.Number)
+			}
+			track = &CuesheetTrack{Number: uint8(n)}
+			if strings.ToUpper(f[2]) != "AUDIO" {
+				track.Type = 1
+			}
+			blk.Tracks = append(blk.Tracks, track)
+			haveStart = false
+
+		case "FLAGS":
+			if track == nil {
+				return nil, errorf("FLAGS before TRACK")
+			}
+			for _, flag := range f[1:] {
+				if strings.ToUpper(flag) == "PRE" {
+					track.PreEmphasis = true
+				}
+			}
+
+		case "ISRC":
+			if err := args(1); err != nil {
+				return nil, err
+			}
+			if track == nil {
+				return nil, errorf("ISRC before TRACK")
+			}
+			if len(f[1]) != CuesheetTrackTrackISRCLen/8 || !isAlnum(f[1]) {
+				return nil, errorf("ISRC %q must be 12 letters or digits", f[1])
+			}
+			track.ISRC = f[1]
+
+		case "PREGAP":
+			if err := args(1); err != nil {
+				return nil, err
+			}
+			if track == nil || haveStart {
+				return nil, errorf("PREGAP must come after TRACK and before INDEX")
+			}
+			if pregap {
+				return nil, errorf("duplicate PREGAP")
+			}
+			if len(blk.Tracks) > 1 {
+				return nil, errorf("PREGAP on track %d is not in the audio stream", track.Number)
+			}
+			n, err := cueSamples(f[1], si, cdda)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			if cdda {
+				blk.LeadinSamples += n
+			}
+			pregap = true
+
+		case "INDEX":
+			if err := args(2); err != nil {
+				return nil, err
+			}
+			if track == nil {
+				return nil, errorf("INDEX before TRACK")
+			}
+			n, err := strconv.ParseUint(f[1], 10, 8)
+			if err != nil || n > 99 {
+				return nil, errorf("invalid index number %q", f[1])
+			}
+			off, err := cueSamples(f[2], si, cdda)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+
+			if len(track.Indexes) == 0 {
+				if n > 1 {
+					return nil, errorf("track %d must start with INDEX 00 or 01", track.Number)
+				}
+				track.Offset = off
+				haveStart = true
+			} else {
+				prev := track.Indexes[len(track.Indexes)-1]
+				if uint8(n) != prev.IndexPoint+1 {
+					return nil, errorf("INDEX %02d follows INDEX %02d", n, prev.IndexPoint)
+				}
+				if off <= track.Offset+prev.SampleOffset {
+					return nil, errorf("INDEX %02d is not after INDEX %02d", n, prev.IndexPoint)
+				}
+			}
+			if k := len(blk.Tracks); k > 1 && len(track.Indexes) == 0 {
+				if prev := blk.Tracks[k-2]; off <= prev.Offset+prev.Indexes[len(prev.Indexes)-1].SampleOffset {
+					return nil, errorf("track %d starts before the end of track %d", track.Number, prev.Number)
+				}
+			}
+			if si.TotalSamples != 0 && off >= si.TotalSamples {
+				return nil, errorf("INDEX %02d at sample %d is beyond the end of the stream at %d", n, off, si.TotalSamples)
+			}
+			track.Indexes = append(track.Indexes, &TrackIndex{SampleOffset: off - track.Offset, IndexPoint: uint8(n)})
+
+		case "REM":
+			if len(f) < 2 {
+				continue
+			}
+			switch f[1] {
+			case "FLAC__lead-in":
+				if len(f) < 3 {
+					return nil, errorf("REM FLAC__lead-in needs a sample count")
+				}
+				n, err := strconv.ParseUint(f[2], 10, 64)
+				if err != nil {
+					return nil, errorf("invalid lead-in %q", f[2])
+				}
+				if cdda {
+					blk.LeadinSamples = n
+				}
+			case "FLAC__lead-out":
+				if len(f) < 4 {
+					return nil, errorf("REM FLAC__lead-out needs a track number and an offset")
+				}
+				n, err := strconv.ParseUint(f[3], 10, 64)
+				if err != nil {
+					return nil, errorf("invalid lead-out offset %q", f[3])
+				}
+				leadout, haveLeadout = n, true
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(blk.Tracks) == 0 {
+		return nil, fmt.Errorf("cue sheet has no tracks")
+	}
+	if track.Indexes == nil {
+		return nil, fmt.Errorf("track %d has no INDEX 01", track.Number)
+	}
+	for _, t := range blk.Tracks {
+		if t.Indexes[len(t.Indexes)-1].IndexPoint == 0 {
+			return nil, fmt.Errorf("track %d has no INDEX 01", t.Number)
+		}
+	}
+
+	switch {
+	case si.TotalSamples != 0:
+		if haveLeadout && leadout != si.TotalSamples {
+			return nil, fmt.Errorf("lead-out at sample %d does not match the stream's %d samples", leadout, si.TotalSamples)
+		}
+		leadout = si.TotalSamples
+	case !haveLeadout:
+		return nil, fmt.Errorf("stream length is unknown and the cue sheet has no REM FLAC__lead-out")
+	}
+	last := track.Offset + track.Indexes[len(track.Indexes)-1].SampleOffset
+	if leadout <= last {
+		return nil, fmt.Errorf("lead-out at sample %d is not after the last index at %d", leadout, last)
+	}
+	if cdda && leadout%CDSamplesPerFrame != 0 {
+		return nil, fmt.Errorf("CD-DA lead-out at sample %d is not a multiple of %d samples", leadout, CDSamplesPerFrame)
+	}
+
+	number := uint8(LeadoutTrack)
+	if cdda {
+		number = CDLeadoutTrack
+	}
+	blk.Tracks = append(blk.Tracks, &CuesheetTrack{Offset: leadout, Number: number})
+	blk.TotalTracks = uint8(len(blk.Tracks))
+	for _, t := range blk.Tracks {
+		t.IndexPoints = uint8(len(t.Indexes))
+	}
+	return blk, nil
+}
+
+// SetCuesheet stores blk as the CUESHEET of m. If m.Blocks is set and has no
+// CUESHEET yet, one is added before any PICTURE, unknown and PADDING blocks.
+func (m *Metadata) SetCuesheet(blk *CuesheetBlock) {
+	m.Cuesheet.Data = blk
+	m.Cuesheet.IsPopulated = true
+	m.setBlock(&m.Cuesheet)
+}
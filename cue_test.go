@@ -0,0 +1,245 @@
+package flac
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteCue(t *testing.T) {
+	f, err := os.Open("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m := new(Metadata)
+	if err := m.Read(f); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := m.Cuesheet.Data.WriteCue(buf, "silence.flac", m.Streaminfo.Data); err != nil {
+		t.Fatal(err)
+	}
+	want := `CATALOG 1234567890123
+FILE "silence.flac" WAVE
+  TRACK 01 AUDIO
+    ISRC 123456789012
+    INDEX 01 00:00:00
+  TRACK 02 DATA
+    FLAGS PRE
+    INDEX 01 00:01:00
+    INDEX 02 00:01:01
+  TRACK 03 AUDIO
+    INDEX 01 00:02:00
+REM FLAC__lead-in 88200
+REM FLAC__lead-out 170 162496
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteCueSampleRate(t *testing.T) {
+	cs := &CuesheetBlock{Tracks: []*CuesheetTrack{
+		{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		{Number: 2, Offset: 48000 * 61, Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 640 * 3, IndexPoint: 1}}},
+		{Number: 255, Offset: 48000 * 120},
+	}}
+	buf := new(bytes.Buffer)
+	if err := cs.WriteCue(buf, "", &StreaminfoBlock{SampleRate: 48000}); err != nil {
+		t.Fatal(err)
+	}
+	want := `FILE "dummy.wav" WAVE
+  TRACK 01 AUDIO
+    INDEX 01 0
+  TRACK 02 AUDIO
+    INDEX 00 2928000
+    INDEX 01 2929920
+REM FLAC__lead-in 0
+REM FLAC__lead-out 255 5760000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := new(CuesheetBlock).WriteCue(buf, "", &StreaminfoBlock{SampleRate: 48000}); err == nil {
+		t.Error("WriteCue accepted a cue sheet without a lead-out track")
+	}
+}
+
+// trimCuesheet strips the NUL padding that a CUESHEET read from a file has.
+func trimCuesheet(cs *CuesheetBlock) {
+	cs.MediaCatalogNumber = trimNUL(cs.MediaCatalogNumber)
+	for _, t := range cs.Tracks {
+		t.ISRC = trimNUL(t.ISRC)
+	}
+}
+
+func TestReadCueRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m := new(Metadata)
+	if err := m.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	want := m.Cuesheet.Data
+	trimCuesheet(want)
+
+	// The stream does not end on a CD frame, which a CD-DA lead-out must.
+	si := *m.Streaminfo.Data
+	si.TotalSamples -= si.TotalSamples % CDSamplesPerFrame
+	want.Tracks[len(want.Tracks)-1].Offset = si.TotalSamples
+
+	buf := new(bytes.Buffer)
+	if err := want.WriteCue(buf, "", &si); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCue(buf, &si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCueRoundTripNonCD(t *testing.T) {
+	// Positions that are not on a 1/75 second frame survive the round trip.
+	si := &StreaminfoBlock{SampleRate: 48000, BitsPerSample: 24, Channels: 2, TotalSamples: 48000 * 120}
+	want := &CuesheetBlock{TotalTracks: 3, Tracks: []*CuesheetTrack{
+		{Number: 1, IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		{Number: 2, Offset: 48000*61 + 7, IndexPoints: 2, Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 641, IndexPoint: 1}}},
+		{Number: 255, Offset: 48000 * 120},
+	}}
+
+	buf := new(bytes.Buffer)
+	if err := want.WriteCue(buf, "", si); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadCue(buf, si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCue(t *testing.T) {
+	const cue = `REM GENRE Rock
+PERFORMER "Someone"
+FILE "Some Album.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    PREGAP 00:00:33
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    FLAGS DCP PRE
+    ISRC USABC1234567
+    INDEX 00 00:10:00
+    INDEX 01 00:12:74
+`
+	cd := &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 44100 * 20}
+	got, err := ReadCue(strings.NewReader(cue), cd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &CuesheetBlock{
+		LeadinSamples: 88200 + 33*588,
+		IsCompactDisc: true,
+		TotalTracks:   3,
+		Tracks: []*CuesheetTrack{
+			{Number: 1, IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 441000, Number: 2, ISRC: "USABC1234567", PreEmphasis: true, IndexPoints: 2,
+				Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 224 * 588, IndexPoint: 1}}},
+			{Offset: 882000, Number: 170},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if _, err := got.Bytes(); err != nil {
+		t.Error(err)
+	}
+
+	// The same sheet for a 48kHz stream is not CD-DA, and may use sample
+	// numbers.
+	hd := &StreaminfoBlock{SampleRate: 48000, Channels: 2, BitsPerSample: 24}
+	got, err = ReadCue(strings.NewReader(cue+"    INDEX 02 700000\nREM FLAC__lead-out 255 960000\n"), hd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IsCompactDisc || got.LeadinSamples != 0 {
+		t.Errorf("IsCompactDisc = %v, LeadinSamples = %d", got.IsCompactDisc, got.LeadinSamples)
+	}
+	tr := got.Tracks[1]
+	if tr.Offset != 480000 || tr.Indexes[1].SampleOffset != 12*48000+74*640-480000 || tr.Indexes[2].SampleOffset != 220000 {
+		t.Errorf("track 2 = %+v %+v %+v", tr, tr.Indexes[1], tr.Indexes[2])
+	}
+	if lo := got.Tracks[2]; lo.Number != 255 || lo.Offset != 960000 {
+		t.Errorf("lead-out = %+v", lo)
+	}
+}
+
+func TestReadCueErrors(t *testing.T) {
+	cd := &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 44100 * 20}
+	const head = "FILE \"a.wav\" WAVE\n  TRACK 01 AUDIO\n"
+	for _, tt := range []struct {
+		name, cue string
+	}{
+		{"no tracks", "FILE \"a.wav\" WAVE\n"},
+		{"no index 01", head + "    INDEX 00 00:00:00\n"},
+		{"track without index", head + "  TRACK 02 AUDIO\n    INDEX 01 00:01:00\n"},
+		{"two files", head + "    INDEX 01 00:00:00\nFILE \"b.wav\" WAVE\n"},
+		{"track before file", "TRACK 01 AUDIO\n"},
+		{"track 100", "FILE \"a.wav\" WAVE\n  TRACK 100 AUDIO\n"},
+		{"track order", head + "    INDEX 01 00:00:00\n  TRACK 01 AUDIO\n"},
+		{"index order", head + "    INDEX 01 00:00:00\n    INDEX 03 00:01:00\n"},
+		{"index position", head + "    INDEX 00 00:01:00\n    INDEX 01 00:00:00\n"},
+		{"track position", head + "    INDEX 01 00:05:00\n  TRACK 02 AUDIO\n    INDEX 01 00:04:00\n"},
+		{"beyond end", head + "    INDEX 01 00:20:00\n"},
+		{"sample number", head + "    INDEX 01 588\n"},
+		{"bad frames", head + "    INDEX 01 00:00:75\n"},
+		{"catalog", "CATALOG 12345\n" + head + "    INDEX 01 00:00:00\n"},
+		{"isrc", head + "    ISRC ABC\n    INDEX 01 00:00:00\n"},
+		{"pregap", head + "    INDEX 01 00:00:00\n  TRACK 02 AUDIO\n    PREGAP 00:02:00\n    INDEX 01 00:05:00\n"},
+		{"quote", "FILE \"a.wav WAVE\n"},
+		{"lead-out mismatch", head + "    INDEX 01 00:00:00\nREM FLAC__lead-out 170 1000\n"},
+	} {
+		if _, err := ReadCue(strings.NewReader(tt.cue), cd); err == nil {
+			t.Errorf("%s: ReadCue succeeded", tt.name)
+		}
+	}
+
+	unknown := &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	if _, err := ReadCue(strings.NewReader(head+"    INDEX 01 00:00:00\n"), unknown); err == nil {
+		t.Error("ReadCue succeeded without a stream length")
+	}
+	if _, err := ReadCue(strings.NewReader(head+"    INDEX 01 00:00:00\nREM FLAC__lead-out 170 1000\n"), unknown); err == nil {
+		t.Error("ReadCue accepted a CD-DA lead-out that is not on a CD frame")
+	}
+	odd := &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16, TotalSamples: 44100*20 + 1}
+	if _, err := ReadCue(strings.NewReader(head+"    INDEX 01 00:00:00\n"), odd); err == nil {
+		t.Error("ReadCue accepted a CD-DA stream that does not end on a CD frame")
+	}
+}
+
+func TestSetCuesheet(t *testing.T) {
+	si, vc, pad := &Streaminfo{IsPopulated: true}, &VorbisComment{IsPopulated: true}, &Padding{IsPopulated: true}
+	m := &Metadata{Blocks: []Block{si, vc, pad}}
+	cs := &CuesheetBlock{Tracks: []*CuesheetTrack{{Number: 255}}}
+	m.SetCuesheet(cs)
+	if !reflect.DeepEqual(m.Blocks, []Block{si, vc, &m.Cuesheet, pad}) || m.Cuesheet.Data != cs {
+		t.Errorf("Blocks = %v", m.Blocks)
+	}
+	m.SetCuesheet(cs)
+	if len(m.Blocks) != 4 {
+		t.Errorf("SetCuesheet added a second CUESHEET: %v", m.Blocks)
+	}
+}
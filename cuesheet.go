@@ -0,0 +1,162 @@
+// cuesheet.go - Validation of CUESHEET blocks.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lead-out track numbers.
+const (
+	CDLeadoutTrack = 170
+	LeadoutTrack   = 255
+)
+
+// CuesheetError describes a part of a cue sheet that breaks the CUESHEET
+// rules.
+type CuesheetError struct {
+	Track  int // Index of the track in the CuesheetBlock's Tracks, or -1.
+	Index  int // Index of the index point in the track's Indexes, or -1.
+	Reason string
+}
+
+func (e *CuesheetError) Error() string {
+	switch {
+	case e.Track < 0:
+		return "cue sheet: " + e.Reason
+	case e.Index < 0:
+		return fmt.Sprintf("track %d: %s", e.Track, e.Reason)
+	}
+	return fmt.Sprintf("track %d index %d: %s", e.Track, e.Index, e.Reason)
+}
+
+// CuesheetErrors lists every part of a cue sheet that breaks the CUESHEET
+// rules.
+type CuesheetErrors []*CuesheetError
+
+func (e CuesheetErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks the cue sheet against the rules of the FLAC format and,
+// for a CD-DA cue sheet, of the Red Book: that the last track is the
+// lead-out, numbered 170 for CD-DA and 255 otherwise, with no index points;
+// that track numbers are unique and not 0, and for CD-DA 1-99; that every
+// other track has index points, numbered from 0 or 1 up by 1 and in order of
+// position; that a CD-DA cue sheet has at most 100 tracks, 100 index points
+// per track and a lead-in of at least 2 seconds, and that its track, lead-out
+// and index positions are multiples of 588 samples; and that reserved bits
+// are zero. If si is not nil and gives the number of samples, Validate also
+// checks that every position is within the stream. Validate returns nil or a
+// CuesheetErrors listing every violation.
+func (blk *CuesheetBlock) Validate(si *StreaminfoBlock) error {
+	var errs CuesheetErrors
+	add := func(track, index int, format string, args ...interface{}) {
+		errs = append(errs, &CuesheetError{track, index, fmt.Sprintf(format, args...)})
+	}
+	cd := blk.IsCompactDisc
+	var total uint64
+	if si != nil {
+		total = si.TotalSamples
+	}
+
+	if blk.reserved != nil {
+		add(-1, -1, "reserved bits are set")
+	}
+	if len(blk.Tracks) == 0 {
+		add(-1, -1, "no lead-out track")
+		return errs
+	}
+	if cd && len(blk.Tracks) > 100 {
+		add(-1, -1, "%d tracks; CD-DA allows at most 99 and the lead-out", len(blk.Tracks))
+	}
+	if cd && blk.LeadinSamples < 2*44100 {
+		add(-1, -1, "CD-DA lead-in of %d samples is shorter than 2 seconds", blk.LeadinSamples)
+	}
+
+	seen := make(map[uint8]bool)
+	for i, t := range blk.Tracks {
+		leadout := i == len(blk.Tracks)-1
+		if t.reserved != nil {
+			add(i, -1, "reserved bits are set")
+		}
+		switch {
+		case t.Number == 0:
+			add(i, -1, "track number 0 is reserved for the lead-in")
+		case seen[t.Number]:
+			add(i, -1, "track number %d is not unique", t.Number)
+		case leadout && cd && t.Number != CDLeadoutTrack:
+			add(i, -1, "CD-DA lead-out track number %d must be %d", t.Number, CDLeadoutTrack)
+		case leadout && !cd && t.Number != LeadoutTrack:
+			add(i, -1, "lead-out track number %d must be %d", t.Number, LeadoutTrack)
+		case !leadout && cd && t.Number > 99:
+			add(i, -1, "CD-DA track number %d must be 1-99", t.Number)
+		case !leadout && !cd && t.Number == LeadoutTrack:
+			add(i, -1, "track number %d is reserved for the lead-out", t.Number)
+		}
+		seen[t.Number] = true
+
+		if cd && t.Offset%CDSamplesPerFrame != 0 {
+			add(i, -1, "CD-DA track offset %d is not a multiple of %d samples", t.Offset, CDSamplesPerFrame)
+		}
+		if total != 0 && (t.Offset > total || !leadout && t.Offset == total) {
+			add(i, -1, "offset %d is beyond the end of the stream at %d", t.Offset, total)
+		}
+
+		if leadout {
+			if len(t.Indexes) != 0 {
+				add(i, -1, "lead-out track has %d index points", len(t.Indexes))
+			}
+			continue
+		}
+		if len(t.Indexes) == 0 {
+			add(i, -1, "no index points")
+		}
+		if cd && len(t.Indexes) > 100 {
+			add(i, -1, "%d index points; CD-DA allows at most 100", len(t.Indexes))
+		}
+		for j, idx := range t.Indexes {
+			if idx.reserved != nil {
+				add(i, j, "reserved bits are set")
+			}
+			if j == 0 && idx.IndexPoint > 1 {
+				add(i, j, "first index point number %d must be 0 or 1", idx.IndexPoint)
+			}
+			if j > 0 {
+				prev := t.Indexes[j-1]
+				if idx.IndexPoint != prev.IndexPoint+1 {
+					add(i, j, "index point number %d does not follow %d", idx.IndexPoint, prev.IndexPoint)
+				}
+				if idx.SampleOffset <= prev.SampleOffset {
+					add(i, j, "offset %d is not after the previous index point's %d", idx.SampleOffset, prev.SampleOffset)
+				}
+			}
+			if cd && idx.SampleOffset%CDSamplesPerFrame != 0 {
+				add(i, j, "CD-DA index offset %d is not a multiple of %d samples", idx.SampleOffset, CDSamplesPerFrame)
+			}
+			if total != 0 && t.Offset+idx.SampleOffset >= total {
+				add(i, j, "position %d is beyond the end of the stream at %d", t.Offset+idx.SampleOffset, total)
+			}
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCuesheetValidate(t *testing.T) {
+	blocks := rawBlocks(t, "testdata/silence-44-s.flac")
+	cs, err := MarshalCuesheetBlock(blocks[MetadataCuesheet])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file's lead-out is not on a CD frame.
+	si := &StreaminfoBlock{TotalSamples: 162496}
+	errs, ok := cs.Validate(si).(CuesheetErrors)
+	if !ok || len(errs) != 1 || errs[0].Track != 3 {
+		t.Errorf("got %v, want an error for the lead-out", errs)
+	}
+
+	// The lead-out is the last 36 bytes of the block.
+	valid := append([]byte(nil), blocks[MetadataCuesheet]...)
+	binary.BigEndian.PutUint64(valid[len(valid)-36:], 276*CDSamplesPerFrame)
+	cs, err = MarshalCuesheetBlock(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Validate(si); err != nil {
+		t.Errorf("Validate of valid cue sheet: %v", err)
+	}
+
+	// Index offsets that are not CD frames are only wrong on a CD.
+	b := append([]byte(nil), valid...)
+	b[480+7] = 1
+	cs, err = MarshalCuesheetBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, ok = cs.Validate(si).(CuesheetErrors)
+	if !ok || len(errs) != 1 || errs[0].Track != 1 || errs[0].Index != 0 {
+		t.Errorf("got %v, want an error for track 1 index 0", errs)
+	}
+	cs.IsCompactDisc = false
+	cs.Tracks[3].Number = LeadoutTrack
+	if err := cs.Validate(si); err != nil {
+		t.Errorf("Validate of non-CD cue sheet: %v", err)
+	}
+
+	// Reserved bits of the sheet, the first track and its index.
+	b = append([]byte(nil), valid...)
+	b[128+8] |= 1
+	b[396+8+1+12] |= 1
+	b[432+11] = 1
+	cs, err = MarshalCuesheetBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, _ = cs.Validate(si).(CuesheetErrors)
+	if len(errs) != 3 || errs[0].Track != -1 || errs[1].Index != -1 || errs[2].Index != 0 {
+		t.Errorf("got %v, want reserved bit errors for the sheet, track 0 and index 0", errs)
+	}
+	// They are written back as they were read.
+	out, err := cs.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Error("reserved bits not preserved by Bytes")
+	}
+}
+
+func TestCuesheetValidateErrors(t *testing.T) {
+	cs := &CuesheetBlock{
+		IsCompactDisc: true,
+		LeadinSamples: 44100,
+		Tracks: []*CuesheetTrack{
+			{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 2}}},
+			{Number: 1, Offset: 100, Indexes: []*TrackIndex{{IndexPoint: 0}, {IndexPoint: 2}}},
+			{Number: 120, Offset: 588 * 10},
+			{Number: 0, Offset: 588 * 20, Indexes: []*TrackIndex{{IndexPoint: 1, SampleOffset: 588 * 100}}},
+			{Number: 255, Offset: 588 * 50, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		},
+	}
+	err := cs.Validate(&StreaminfoBlock{TotalSamples: 588 * 40})
+	errs, ok := err.(CuesheetErrors)
+	if !ok {
+		t.Fatalf("got %v, want CuesheetErrors", err)
+	}
+	for _, want := range []string{
+		"cue sheet: CD-DA lead-in of 44100 samples is shorter than 2 seconds",
+		"track 0 index 0: first index point number 2 must be 0 or 1",
+		"track 1: track number 1 is not unique",
+		"track 1: CD-DA track offset 100 is not a multiple of 588 samples",
+		"track 1 index 1: index point number 2 does not follow 0",
+		"track 1 index 1: offset 0 is not after the previous index point's 0",
+		"track 2: CD-DA track number 120 must be 1-99",
+		"track 2: no index points",
+		"track 3: track number 0 is reserved for the lead-in",
+		"track 3 index 0: position 70560 is beyond the end of the stream at 23520",
+		"track 4: CD-DA lead-out track number 255 must be 170",
+		"track 4: offset 29400 is beyond the end of the stream at 23520",
+		"track 4: lead-out track has 1 index points",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if len(errs) != 13 {
+		t.Errorf("got %d errors: %v", len(errs), err)
+	}
+
+	if err := new(CuesheetBlock).Validate(nil); err == nil {
+		t.Error("Validate accepted a cue sheet without tracks")
+	}
+}
+
+func TestReadStrictCuesheet(t *testing.T) {
+	raw, err := os.ReadFile("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(Metadata)
+	if err := m.Read(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	m.Cuesheet.Data.Tracks[0].Number = 2
+	// A bad SEEKTABLE must not hide the cue sheet's errors.
+	st := m.Seektable.Data
+	st[0], st[len(st)-1] = st[len(st)-1], st[0]
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	err = new(Metadata).ReadStrict(buf)
+	var cerrs CuesheetErrors
+	if !errors.As(err, &cerrs) {
+		t.Error("ReadStrict accepted duplicate track numbers")
+	}
+	var serrs SeektableErrors
+	if !errors.As(err, &serrs) {
+		t.Error("ReadStrict accepted unsorted seek points")
+	}
+}
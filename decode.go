@@ -0,0 +1,487 @@
+// decode.go - Decoding of FLAC audio frames to PCM samples.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Frame is a decoded audio frame.
+type Frame struct {
+	Header *FrameHeader
+
+	// Offset is the byte offset of the frame, relative to the position of
+	// the reader passed to NewDecoder.
+	Offset int64
+
+	// FirstSample is the number of the first sample in Samples, counting
+	// from the start of the stream.
+	FirstSample uint64
+
+	// Samples holds Header.BlockSize samples for each of Header.Channels
+	// channels, interleaved: the first sample of every channel, then the
+	// second, and so on. The first frame after a Seek holds only the
+	// samples from the one sought on.
+	Samples []int32
+
+	// CRC16 is the CRC-16 stored at the end of the frame.
+	CRC16 uint16
+
+	body []byte // Encoded subframes and padding, if the Decoder keeps them.
+}
+
+// Decoder decodes the audio frames that follow the metadata of a FLAC
+// stream.
+type Decoder struct {
+	si    *StreaminfoBlock
+	r     *bufio.Reader
+	br    *bitReader
+	start int64     // Offset of the frame being decoded.
+	ch    int       // Channel of the subframe being decoded.
+	sub   [][]int64 // Decoded subframes, one per channel.
+
+	rs         io.ReadSeeker // The stream, if it can seek.
+	base       int64         // Position of the first frame in rs.
+	seekpoints []*SeekpointBlock
+	pending    *Frame // Frame found by Seek, for the next call to Next.
+
+	err error // Set if no frame can be decoded at all.
+}
+
+// NewDecoder returns a Decoder that reads frames from r, which must be
+// positioned at the first audio frame, such as a reader that Metadata.Read
+// has just read the metadata from. si is the stream's STREAMINFO, which
+// supplies the values that frame headers may leave out; if it is nil, Next
+// returns an error wrapping ErrInvalidValue. If r is an io.ReadSeeker, the
+// Decoder can Seek.
+func NewDecoder(r io.Reader, si *StreaminfoBlock) *Decoder {
+	br := bufio.NewReader(r)
+	d := &Decoder{si: si, r: br, br: &bitReader{r: br}}
+	if si == nil {
+		d.err = errNoStreaminfo
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if off, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			d.rs, d.base = rs, off
+		}
+	}
+	return d
+}
+
+// Open reads the metadata from r and returns it with a Decoder for the audio
+// frames that follow. If r is an io.ReadSeeker, the Decoder can Seek, using
+// the SEEKTABLE if there is one. A stream without a STREAMINFO block is
+// rejected with an error wrapping ErrInvalidValue.
+func Open(r io.Reader) (*Metadata, *Decoder, error) {
+	m := new(Metadata)
+	if err := m.Read(r); err != nil {
+		return nil, nil, err
+	}
+	si, err := m.streaminfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	d := NewDecoder(r, si)
+	if m.Seektable.IsPopulated {
+		d.seekpoints = m.Seektable.Data
+	}
+	return m, d, nil
+}
+
+// resync skips to the next plausible frame header after a frame failed to
+// decode, returning the number of bytes skipped.
+func (d *Decoder) resync() (int64, error) {
+	d.br.align()
+	skipped, err := skipToFrame(d.r, d.si)
+	d.br.n += skipped
+	return skipped, err
+}
+
+// Next decodes the next frame. It returns io.EOF when there are no more
+// frames. Decoding failures are returned as a *ParseError with offsets
+// relative to the start of the frame. If only the frame's CRC-16 does not
+// match, Next returns the decoded frame along with an error wrapping
+// ErrChecksum.
+func (d *Decoder) Next() (*Frame, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if frame := d.pending; frame != nil {
+		d.pending = nil
+		return frame, nil
+	}
+
+	d.br.align()
+	d.br.crc = 0
+	d.br.raw = nil
+	d.start = d.br.n
+
+	h, err := ReadFrameHeader(d.br, d.si)
+	if err != nil {
+		return nil, err
+	}
+	frame := &Frame{Header: h, Offset: d.start, FirstSample: h.FirstSample(d.si)}
+	hdrLen := len(d.br.raw)
+
+	for len(d.sub) < int(h.Channels) {
+		d.sub = append(d.sub, nil)
+	}
+	for ch := 0; ch < int(h.Channels); ch++ {
+		if cap(d.sub[ch]) < int(h.BlockSize) {
+			d.sub[ch] = make([]int64, h.BlockSize)
+		}
+		d.sub[ch] = d.sub[ch][:h.BlockSize]
+
+		// The side channel needs an extra bit.
+		bps := uint(h.BitsPerSample)
+		switch {
+		case ch == 1 && (h.ChannelAssignment == ChannelsLeftSide || h.ChannelAssignment == ChannelsMidSide),
+			ch == 0 && h.ChannelAssignment == ChannelsRightSide:
+			bps++
+		}
+		d.ch = ch
+		if err := d.subframe(d.sub[ch], bps); err != nil {
+			return nil, err
+		}
+	}
+	d.decorrelate(h)
+
+	frame.Samples = make([]int32, int(h.BlockSize)*int(h.Channels))
+	for ch, s := range d.sub[:h.Channels] {
+		for i, v := range s {
+			frame.Samples[i*int(h.Channels)+ch] = int32(v)
+		}
+	}
+
+	// http://flac.sourceforge.net/format.html#frame_footer
+	// The subframes are padded with zero bits to a byte boundary, followed
+	// by a CRC-16 of everything from the sync code on.
+	d.br.align()
+	if d.br.keep {
+		frame.body = d.br.raw[hdrLen:]
+	}
+	crc := d.br.crc
+	v, err := d.br.bits(16)
+	if err != nil {
+		return nil, d.readError("frame CRC-16", err)
+	}
+	frame.CRC16 = uint16(v)
+	if frame.CRC16 != crc {
+		return frame, &ParseError{
+			Type:   MetadataInvalid,
+			Offset: d.br.n - 2 - d.start,
+			Field:  "frame CRC-16",
+			Err:    fmt.Errorf("%w: frame has %#04x, computed %#04x", ErrChecksum, frame.CRC16, crc),
+		}
+	}
+	return frame, nil
+}
+
+// decorrelate restores the left and right channels of a stereo frame.
+func (d *Decoder) decorrelate(h *FrameHeader) {
+	if h.ChannelAssignment == ChannelsIndependent {
+		return
+	}
+	a, b := d.sub[0], d.sub[1]
+	for i := range a {
+		switch h.ChannelAssignment {
+		case ChannelsLeftSide:
+			b[i] = a[i] - b[i]
+		case ChannelsRightSide:
+			a[i] += b[i]
+		case ChannelsMidSide:
+			mid := a[i]<<1 | b[i]&1
+			a[i], b[i] = (mid+b[i])>>1, (mid-b[i])>>1
+		}
+	}
+}
+
+// field names a field of the subframe being decoded.
+func (d *Decoder) field(name string) string {
+	return fmt.Sprintf("subframe %d %s", d.ch, name)
+}
+
+// invalid returns a ParseError for an invalid value in field at the current
+// position.
+func (d *Decoder) invalid(field, format string, args ...interface{}) error {
+	return invalidValue(MetadataInvalid, int(d.br.n-d.start), field, format, args...)
+}
+
+// readError returns a ParseError for a failure to read field.
+func (d *Decoder) readError(field string, err error) error {
+	return readError(MetadataInvalid, d.br.n-d.start, field, err)
+}
+
+// subframe decodes a subframe of bps bits per sample into s.
+func (d *Decoder) subframe(s []int64, bps uint) error {
+	// http://flac.sourceforge.net/format.html#subframe_header
+	// Field Len  | Data
+	// -----------+--------------------------------------------------------
+	// 1          | Zero bit padding.
+	//            |
+	// 6          | Subframe type:
+	//            |   000000 : SUBFRAME_CONSTANT
+	//            |   000001 : SUBFRAME_VERBATIM
+	//            |   00001x, 0001xx, 01xxxx : reserved
+	//            |   001xxx : SUBFRAME_FIXED, xxx=order if <= 4, else reserved
+	//            |   1xxxxx : SUBFRAME_LPC, xxxxx=order-1
+	//            |
+	// 1+k        | 'Wasted bits-per-sample' flag, followed by k-1 zero bits
+	//            | and a one bit if set.
+	v, err := d.br.bits(8)
+	if err != nil {
+		return d.readError(d.field("header"), err)
+	}
+	if v&0x80 != 0 {
+		return d.invalid(d.field("header"), "padding bit must be 0")
+	}
+
+	var wasted uint
+	if v&0x01 != 0 {
+		k, err := d.br.unary()
+		if err != nil {
+			return d.readError(d.field("wasted bits"), err)
+		}
+		if k+1 >= uint64(bps) {
+			return d.invalid(d.field("wasted bits"), "%d wasted bits of %d", k+1, bps)
+		}
+		wasted = uint(k) + 1
+		bps -= wasted
+	}
+
+	switch code := v >> 1 & 0x3F; {
+	case code == 0:
+		err = d.constant(s, bps)
+	case code == 1:
+		err = d.verbatim(s, bps)
+	case code&0x38 == 0x08 && code&0x07 <= 4:
+		err = d.fixed(s, bps, int(code&0x07))
+	case code&0x20 != 0:
+		err = d.lpc(s, bps, int(code&0x1F)+1)
+	default:
+		err = d.invalid(d.field("type"), "reserved subframe type %#02x", code)
+	}
+	if err != nil {
+		return err
+	}
+
+	if wasted > 0 {
+		for i := range s {
+			s[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) constant(s []int64, bps uint) error {
+	v, err := d.br.signed(bps)
+	if err != nil {
+		return d.readError(d.field("constant"), err)
+	}
+	for i := range s {
+		s[i] = v
+	}
+	return nil
+}
+
+func (d *Decoder) verbatim(s []int64, bps uint) error {
+	for i := range s {
+		v, err := d.br.signed(bps)
+		if err != nil {
+			return d.readError(d.field("verbatim sample"), err)
+		}
+		s[i] = v
+	}
+	return nil
+}
+
+// warmup reads the unencoded samples that start a predicted subframe.
+func (d *Decoder) warmup(s []int64, bps uint, order int) error {
+	if order > len(s) {
+		return d.invalid(d.field("predictor order"), "order %d exceeds block size %d", order, len(s))
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.signed(bps)
+		if err != nil {
+			return d.readError(d.field("warm-up sample"), err)
+		}
+		s[i] = v
+	}
+	return nil
+}
+
+// fixedCoefficients are the coefficients of the fixed predictors of order 0
+// through 4.
+var fixedCoefficients = [5][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+func (d *Decoder) fixed(s []int64, bps uint, order int) error {
+	if err := d.warmup(s, bps, order); err != nil {
+		return err
+	}
+	if err := d.residual(s, order); err != nil {
+		return err
+	}
+	predict(s, fixedCoefficients[order], 0)
+	return nil
+}
+
+func (d *Decoder) lpc(s []int64, bps uint, order int) error {
+	// http://flac.sourceforge.net/format.html#subframe_lpc
+	// Field Len  | Data
+	// -----------+--------------------------------------------------------
+	// bps*order  | Unencoded warm-up samples.
+	//            |
+	// 4          | (Quantized linear predictor coefficients' precision in
+	//            | bits)-1 (1111 = invalid).
+	//            |
+	// 5          | Quantized linear predictor coefficient shift needed in
+	//            | bits (NOTE: this number is signed two's-complement).
+	//            |
+	// precision  | Unencoded predictor coefficients (order * precision
+	// * order    | bits; each coefficient is signed two's-complement).
+	//            |
+	// ?          | Encoded residual.
+	if err := d.warmup(s, bps, order); err != nil {
+		return err
+	}
+
+	v, err := d.br.bits(4)
+	if err != nil {
+		return d.readError(d.field("LPC precision"), err)
+	}
+	if v == 0x0F {
+		return d.invalid(d.field("LPC precision"), "invalid precision code 15")
+	}
+	prec := uint(v) + 1
+
+	shift, err := d.br.signed(5)
+	if err != nil {
+		return d.readError(d.field("LPC shift"), err)
+	}
+	if shift < 0 {
+		return d.invalid(d.field("LPC shift"), "negative shift %d", shift)
+	}
+
+	coeffs := make([]int64, order)
+	for i := range coeffs {
+		if coeffs[i], err = d.br.signed(prec); err != nil {
+			return d.readError(d.field("LPC coefficient"), err)
+		}
+	}
+
+	if err := d.residual(s, order); err != nil {
+		return err
+	}
+	predict(s, coeffs, uint(shift))
+	return nil
+}
+
+// predict adds the prediction from coeffs, shifted right by shift, to the
+// residuals in s that follow the len(coeffs) warm-up samples.
+func predict(s []int64, coeffs []int64, shift uint) {
+	for i := len(coeffs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * s[i-j-1]
+		}
+		s[i] += sum >> shift
+	}
+}
+
+// residual decodes the partitioned Rice coded residual of a subframe with
+// the given predictor order into s[order:].
+func (d *Decoder) residual(s []int64, order int) error {
+	// http://flac.sourceforge.net/format.html#residual
+	// Field Len  | Data
+	// -----------+--------------------------------------------------------
+	// 2          | Residual coding method:
+	//            |   00 : partitioned Rice coding with 4-bit parameter
+	//            |   01 : partitioned Rice coding with 5-bit parameter
+	//            |   10-11 : reserved
+	//            |
+	// 4          | Partition order: the residual is split into
+	//            | 2^order partitions. The first partition holds
+	//            | (blocksize >> order) - predictor order samples, the
+	//            | others blocksize >> order.
+	//            |
+	// ?          | Each partition: the Rice parameter, or all ones as an
+	//            | escape code followed by a 5 bit sample size and the
+	//            | samples unencoded; then the Rice coded samples.
+	v, err := d.br.bits(6)
+	if err != nil {
+		return d.readError(d.field("residual coding method"), err)
+	}
+	method, porder := v>>4, uint(v&0x0F)
+
+	var paramBits uint
+	switch method {
+	case 0:
+		paramBits = 4
+	case 1:
+		paramBits = 5
+	default:
+		return d.invalid(d.field("residual coding method"), "reserved method %d", method)
+	}
+	escape := uint64(1)<<paramBits - 1
+
+	n := len(s) >> porder
+	if n<<porder != len(s) || n < order {
+		return d.invalid(d.field("partition order"), "partition order %d does not fit block size %d and predictor order %d", porder, len(s), order)
+	}
+
+	i := order
+	for p := 0; p < 1<<porder; p++ {
+		end := (p + 1) * n
+		param, err := d.br.bits(paramBits)
+		if err != nil {
+			return d.readError(d.field("Rice parameter"), err)
+		}
+
+		if param == escape {
+			bps, err := d.br.bits(5)
+			if err != nil {
+				return d.readError(d.field("escaped sample size"), err)
+			}
+			for ; i < end; i++ {
+				if s[i], err = d.br.signed(uint(bps)); err != nil {
+					return d.readError(d.field("escaped residual"), err)
+				}
+			}
+			continue
+		}
+
+		k := uint(param)
+		for ; i < end; i++ {
+			q, err := d.br.unary()
+			if err != nil {
+				return d.readError(d.field("residual"), err)
+			}
+			r, err := d.br.bits(k)
+			if err != nil {
+				return d.readError(d.field("residual"), err)
+			}
+			u := q<<k | r
+			s[i] = int64(u>>1) ^ -int64(u&1)
+		}
+	}
+	return nil
+}
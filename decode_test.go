@@ -0,0 +1,103 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// decodeAll decodes every frame of a test file and returns its metadata and
+// the MD5 of the decoded samples, computed the way the encoder computes the
+// STREAMINFO MD5 signature.
+func decodeAll(t *testing.T, name string) (*Metadata, string, uint64) {
+	m, audio := openAudio(t, name)
+	si := m.Streaminfo.Data
+	d := NewDecoder(bytes.NewReader(audio), si)
+
+	h := md5.New()
+	var samples uint64
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: frame %d: %v", name, samples/uint64(si.MaxBlockSize), err)
+		}
+		if len(frame.Samples) != int(frame.Header.BlockSize)*int(si.Channels) {
+			t.Fatalf("%s: frame at %d has %d samples", name, frame.Offset, len(frame.Samples))
+		}
+		h.Write(appendSamples(nil, frame.Samples, si.BitsPerSample))
+		samples += uint64(frame.Header.BlockSize)
+	}
+	return m, hex.EncodeToString(h.Sum(nil)), samples
+}
+
+func TestDecode(t *testing.T) {
+	for _, name := range []string{"testdata/44100-16-mono.flac", "testdata/silence-44-s.flac"} {
+		m, sum, samples := decodeAll(t, name)
+		si := m.Streaminfo.Data
+		if samples != si.TotalSamples {
+			t.Errorf("%s: decoded %d samples, want %d", name, samples, si.TotalSamples)
+		}
+		if sum != si.MD5Signature {
+			t.Errorf("%s: MD5 of decoded samples = %s, want %s", name, sum, si.MD5Signature)
+		}
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	m, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	audio = append([]byte(nil), audio...)
+
+	// Find the second frame and flip a bit in the last byte of the first
+	// frame's audio data, just before its CRC-16.
+	d := NewDecoder(bytes.NewReader(audio), m.Streaminfo.Data)
+	if _, err := d.Next(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio[second.Offset-3] ^= 0x01
+
+	d = NewDecoder(bytes.NewReader(audio), m.Streaminfo.Data)
+	frame, err := d.Next()
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("got %v, want a checksum error", err)
+	}
+	if frame == nil {
+		t.Fatal("no frame returned with the checksum error")
+	}
+	if next, err := d.Next(); err != nil || next.Header.Number != 1 {
+		t.Errorf("decoding after a checksum error: got frame %+v, %v", next, err)
+	}
+
+	d = NewDecoder(bytes.NewReader(audio[:second.Offset-10]), m.Streaminfo.Data)
+	if _, err := d.Next(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("truncated frame: got %v, want ErrTruncated", err)
+	}
+}
+
+// noStreaminfo returns a stream whose metadata is a single PADDING block,
+// followed by the audio frames of a test file.
+func noStreaminfo(t *testing.T) []byte {
+	_, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	b := append([]byte(FlacSignature), 0x81, 0, 0, 1, 0)
+	return append(b, audio...)
+}
+
+func TestDecodeNoStreaminfo(t *testing.T) {
+	b := noStreaminfo(t)
+	if _, _, err := Open(bytes.NewReader(b)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Open: got %v, want ErrInvalidValue", err)
+	}
+	d := NewDecoder(bytes.NewReader(b[len(FlacSignature)+5:]), nil)
+	if _, err := d.Next(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Next: got %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,194 @@
+// discid.go - Disc identifiers computed from CUESHEET blocks.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// musicBrainzEncoding is the base64 variant of MusicBrainz disc IDs, which
+// are used in URLs.
+var musicBrainzEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._").WithPadding('-')
+
+// cdTrack is a track of a CD's table of contents.
+type cdTrack struct {
+	number uint8
+	sector uint32 // Absolute position of INDEX 01, in 1/75 second frames.
+	lba    uint32 // Position of INDEX 01 from the start of the program area.
+	data   bool
+}
+
+// toc returns the table of contents of the CD described by the cue sheet:
+// its tracks and the position of the lead-out, in frames from the start of
+// the disc, lead-in included.
+func (blk *CuesheetBlock) toc() ([]cdTrack, uint32, error) {
+	if !blk.IsCompactDisc {
+		return nil, 0, fmt.Errorf("cue sheet does not describe a CD")
+	}
+	if len(blk.Tracks) < 2 {
+		return nil, 0, fmt.Errorf("cue sheet has no tracks")
+	}
+
+	var tracks []cdTrack
+	for _, t := range blk.Tracks[:len(blk.Tracks)-1] {
+		var index01 *TrackIndex
+		for _, idx := range t.Indexes {
+			if idx.IndexPoint == 1 {
+				index01 = idx
+			}
+		}
+		if index01 == nil {
+			return nil, 0, fmt.Errorf("track %d has no INDEX 01", t.Number)
+		}
+		off := t.Offset + index01.SampleOffset
+		sector := (blk.LeadinSamples + off) / CDSamplesPerFrame
+		tracks = append(tracks, cdTrack{t.Number, uint32(sector), uint32(off / CDSamplesPerFrame), t.Type != 0})
+	}
+	leadout := (blk.LeadinSamples + blk.Tracks[len(blk.Tracks)-1].Offset) / CDSamplesPerFrame
+	return tracks, uint32(leadout), nil
+}
+
+// FreeDBDiscID returns the FreeDB (CDDB) disc ID of the CD described by the
+// cue sheet, which is conventionally formatted with %08x. Like metaflac and
+// the CD itself, the track positions count the lead-in, so the ID is only
+// right if LeadinSamples is.
+func (blk *CuesheetBlock) FreeDBDiscID() (uint32, error) {
+	tracks, leadout, err := blk.toc()
+	if err != nil {
+		return 0, err
+	}
+
+	var sum uint32
+	for _, t := range tracks {
+		for n := t.sector / CDFramesPerSecond; n > 0; n /= 10 {
+			sum += n % 10
+		}
+	}
+	length := leadout/CDFramesPerSecond - tracks[0].sector/CDFramesPerSecond
+	return sum%0xFF<<24 | length<<8 | uint32(len(tracks)), nil
+}
+
+// musicBrainzTOC returns the first and last track numbers, the lead-out and
+// the track positions that make up a MusicBrainz disc ID. As on a CD Extra
+// disc, data tracks at the end of the disc are left out, along with the gap
+// of 11400 frames between the audio and data sessions.
+func (blk *CuesheetBlock) musicBrainzTOC() (first, last uint8, leadout uint32, offsets []uint32, err error) {
+	tracks, leadout, err := blk.toc()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	for len(tracks) > 1 && tracks[len(tracks)-1].data {
+		leadout = tracks[len(tracks)-1].sector - 11400
+		tracks = tracks[:len(tracks)-1]
+	}
+	for _, t := range tracks {
+		offsets = append(offsets, t.sector)
+	}
+	return tracks[0].number, tracks[len(tracks)-1].number, leadout, offsets, nil
+}
+
+// MusicBrainzDiscID returns the MusicBrainz disc ID of the CD described by
+// the cue sheet.
+func (blk *CuesheetBlock) MusicBrainzDiscID() (string, error) {
+	first, last, leadout, offsets, err := blk.musicBrainzTOC()
+	if err != nil {
+		return "", err
+	}
+
+	// The ID is a hash of the hexadecimal track numbers and positions, with
+	// the lead-out in place of track 0 and unused tracks up to 99 as zero.
+	h := sha1.New()
+	fmt.Fprintf(h, "%02X%02X%08X", first, last, leadout)
+	for i := 1; i <= 99; i++ {
+		var off uint32
+		if n := i - int(first); n >= 0 && n < len(offsets) {
+			off = offsets[n]
+		}
+		fmt.Fprintf(h, "%08X", off)
+	}
+	return musicBrainzEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// MusicBrainzTOC returns the table of contents of the CD described by the cue
+// sheet in the form the MusicBrainz web service accepts for disc ID lookups:
+// the first and last track numbers, the lead-out and the position of each
+// track, in frames, separated by spaces.
+func (blk *CuesheetBlock) MusicBrainzTOC() (string, error) {
+	first, last, leadout, offsets, err := blk.musicBrainzTOC()
+	if err != nil {
+		return "", err
+	}
+	f := []string{strconv.Itoa(int(first)), strconv.Itoa(int(last)), strconv.Itoa(int(leadout))}
+	for _, off := range offsets {
+		f = append(f, strconv.Itoa(int(off)))
+	}
+	return strings.Join(f, " "), nil
+}
+
+// CTDBTOCID returns the TOC ID of the CD described by the cue sheet in the
+// CUETools database. Like the MusicBrainz disc ID, it leaves out the data
+// tracks of a CD Extra disc.
+func (blk *CuesheetBlock) CTDBTOCID() (string, error) {
+	_, _, leadout, offsets, err := blk.musicBrainzTOC()
+	if err != nil {
+		return "", err
+	}
+
+	// The ID is a hash of the hexadecimal track positions relative to the
+	// first track, ending with the length of the audio, padded with zeros
+	// to 100 positions.
+	h := sha1.New()
+	for _, off := range offsets[1:] {
+		fmt.Fprintf(h, "%08X", off-offsets[0])
+	}
+	fmt.Fprintf(h, "%08X", leadout-offsets[0])
+	io.WriteString(h, strings.Repeat("0", (100-len(offsets))*8))
+	return musicBrainzEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// AccurateRipDiscID returns the disc ID of the CD described by the cue sheet
+// in the AccurateRip database, in the form used in the names of its files:
+// the number of tracks, the two AccurateRip IDs and the FreeDB disc ID, as
+// in "003-0000042b-00000b4d-09000303".
+func (blk *CuesheetBlock) AccurateRipDiscID() (string, error) {
+	tracks, _, err := blk.toc()
+	if err != nil {
+		return "", err
+	}
+	freedb, err := blk.FreeDBDiscID()
+	if err != nil {
+		return "", err
+	}
+
+	// The IDs use positions from the start of the program area, whatever
+	// the lead-in.
+	leadout := uint32(blk.Tracks[len(blk.Tracks)-1].Offset / CDSamplesPerFrame)
+	var id1, id2 uint32
+	for i, t := range tracks {
+		lba := t.lba
+		id1 += lba
+		if lba == 0 {
+			lba = 1
+		}
+		id2 += lba * uint32(i+1)
+	}
+	id1 += leadout
+	id2 += leadout * uint32(len(tracks)+1)
+	return fmt.Sprintf("%03d-%08x-%08x-%08x", len(tracks), id1, id2, freedb), nil
+}
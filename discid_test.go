@@ -0,0 +1,113 @@
+package flac
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// cdCuesheet returns a CD cue sheet with tracks 1-n at the given absolute
+// frame positions, followed by a lead-out at leadout.
+func cdCuesheet(leadout uint32, sectors ...uint32) *CuesheetBlock {
+	const leadin = 150
+	blk := &CuesheetBlock{LeadinSamples: leadin * CDSamplesPerFrame, IsCompactDisc: true}
+	for i, s := range sectors {
+		blk.Tracks = append(blk.Tracks, &CuesheetTrack{
+			Offset:  uint64(s-leadin) * CDSamplesPerFrame,
+			Number:  uint8(i + 1),
+			Indexes: []*TrackIndex{{IndexPoint: 1}},
+		})
+	}
+	blk.Tracks = append(blk.Tracks, &CuesheetTrack{Offset: uint64(leadout-leadin) * CDSamplesPerFrame, Number: 170})
+	return blk
+}
+
+func TestDiscID(t *testing.T) {
+	blk := cdCuesheet(303602,
+		150, 9700, 25887, 39297, 53795, 63735, 77517, 94877, 107270,
+		123552, 135522, 148422, 161197, 174790, 192022, 205545,
+		218010, 228700, 247590, 264950, 289987)
+
+	freedb, err := blk.FreeDBDiscID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freedb != 0x1e0fce15 {
+		t.Errorf("FreeDB disc ID = %08x, want 1e0fce15", freedb)
+	}
+	mb, err := blk.MusicBrainzDiscID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HZM95sSVLn1H3RdZogStKFwgZHA-"; mb != want {
+		t.Errorf("MusicBrainz disc ID = %s, want %s", mb, want)
+	}
+	toc, err := blk.MusicBrainzTOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 21 303602 150 9700 25887 39297 53795 63735 77517 94877 107270 123552 135522 148422 161197 174790 192022 205545 218010 228700 247590 264950 289987"; toc != want {
+		t.Errorf("MusicBrainz TOC = %q, want %q", toc, want)
+	}
+}
+
+func TestDiscIDCuesheet(t *testing.T) {
+	f, err := os.Open("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m := new(Metadata)
+	if err := m.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	blk := m.Cuesheet.Data
+
+	// Track 2 is a data track, but not at the end of the disc.
+	if toc, err := blk.MusicBrainzTOC(); err != nil || toc != "1 3 426 150 225 300" {
+		t.Errorf("MusicBrainz TOC = %q, %v", toc, err)
+	}
+	if id, err := blk.MusicBrainzDiscID(); err != nil || id != "FzDihppegm3zHQF6Z8djltDhVEs-" {
+		t.Errorf("MusicBrainz disc ID = %q, %v", id, err)
+	}
+	if id, err := blk.FreeDBDiscID(); err != nil || id != 0x09000303 {
+		t.Errorf("FreeDB disc ID = %08x, %v", id, err)
+	}
+	if id, err := blk.AccurateRipDiscID(); err != nil || id != "003-000001f5-000006a9-09000303" {
+		t.Errorf("AccurateRip disc ID = %q, %v", id, err)
+	}
+	// The AccurateRip IDs don't depend on the lead-in; only the FreeDB
+	// part of the disc ID does.
+	for _, leadin := range []uint64{0, 3 * CDFramesPerSecond * CDSamplesPerFrame} {
+		cs := *blk
+		cs.LeadinSamples = leadin
+		if id, err := cs.AccurateRipDiscID(); err != nil || !strings.HasPrefix(id, "003-000001f5-000006a9-") {
+			t.Errorf("AccurateRip disc ID with %d lead-in samples = %q, %v", leadin, id, err)
+		}
+	}
+	if id, err := blk.CTDBTOCID(); err != nil || id != "FrTTYU_0YKQSNB771zngHGP3qzE-" {
+		t.Errorf("CTDB TOC ID = %q, %v", id, err)
+	}
+}
+
+func TestDiscIDDataTrack(t *testing.T) {
+	// A CD Extra disc: the data session is left out of the MusicBrainz TOC.
+	blk := cdCuesheet(40000, 150, 10000, 30000)
+	blk.Tracks[2].Type = 1
+	if toc, err := blk.MusicBrainzTOC(); err != nil || toc != "1 2 18600 150 10000" {
+		t.Errorf("MusicBrainz TOC = %q, %v", toc, err)
+	}
+	if id, err := blk.FreeDBDiscID(); err != nil || id&0xFF != 3 {
+		t.Errorf("FreeDB disc ID = %08x, %v; want 3 tracks", id, err)
+	}
+
+	blk.IsCompactDisc = false
+	if _, err := blk.MusicBrainzDiscID(); err == nil {
+		t.Error("MusicBrainzDiscID accepted a non-CD cue sheet")
+	}
+	blk = cdCuesheet(40000, 150)
+	blk.Tracks[0].Indexes[0].IndexPoint = 0
+	if _, err := blk.FreeDBDiscID(); err == nil {
+		t.Error("FreeDBDiscID accepted a track without INDEX 01")
+	}
+}
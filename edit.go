@@ -0,0 +1,200 @@
+// edit.go - In-place editing of FLAC metadata.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DefaultPadding is the size, in bytes, of the PADDING block written when a
+// file has to be rewritten because its metadata no longer fits.
+const DefaultPadding = 8192
+
+// Edit reads the metadata of the FLAC file at path, calls fn to modify it and
+// writes the result back with WriteFile. The file is left untouched if fn
+// returns an error.
+func Edit(path string, fn func(m *Metadata) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	m := new(Metadata)
+	err = m.Read(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(m); err != nil {
+		return err
+	}
+	return WriteFile(path, m)
+}
+
+// WriteFile replaces the metadata of the FLAC file at path with m, leaving the
+// audio frames untouched. Any PADDING in m is discarded and recomputed: if the
+// new metadata fits in the space occupied by the old metadata, only that region
+// of the file is overwritten and PADDING absorbs the difference. Otherwise the
+// whole file is rewritten to a temporary file, with DefaultPadding bytes of
+// padding, which then atomically replaces the original. On success m.Paddings
+// (and m.Blocks, if set) holds only the PADDING block that was written.
+func WriteFile(path string, m *Metadata) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := new(Metadata).Read(f); err != nil {
+		return err
+	}
+	audio, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := m.encodeBlocks()
+	if err != nil {
+		return err
+	}
+	size := int64(len(FlacSignature))
+	for i := 0; i < len(blocks); i++ {
+		if blocks[i].Type == MetadataPadding {
+			blocks = append(blocks[:i], blocks[i+1:]...)
+			i--
+			continue
+		}
+		size += MetadataBlockHeaderLen/8 + int64(len(blocks[i].Data))
+	}
+
+	// The smallest PADDING block is a bare header.
+	const hdrLen = MetadataBlockHeaderLen / 8
+	switch pad := audio - size - hdrLen; {
+	case size == audio:
+		return writeInPlace(f, m, blocks, nil)
+	case pad >= 0 && pad < 1<<24:
+		return writeInPlace(f, m, blocks, make([]byte, pad))
+	}
+	f.Close()
+	return rewrite(path, audio, m, blocks, make([]byte, DefaultPadding))
+}
+
+// withPadding returns blocks followed by a PADDING block of len(pad) bytes, if
+// pad is not nil, and the Padding that describes it.
+func withPadding(blocks []*encodedBlock, pad []byte) ([]*encodedBlock, *Padding) {
+	if pad == nil {
+		return blocks, nil
+	}
+	hdr := &MetadataBlockHeader{Type: MetadataPadding, Length: uint32(len(pad)), Last: true}
+	return append(blocks, &encodedBlock{MetadataPadding, pad}), &Padding{hdr, nil, true}
+}
+
+// setPadding replaces the padding of m with p, which may be nil, in both the
+// Paddings field and, if it is in use, the Blocks list.
+func (m *Metadata) setPadding(p *Padding) {
+	m.Paddings = nil
+	if p != nil {
+		m.Paddings = []*Padding{p}
+	}
+	if m.Blocks == nil {
+		return
+	}
+
+	var blocks []Block
+	for _, blk := range m.Blocks {
+		if blk.BlockHeader().Type != MetadataPadding {
+			blocks = append(blocks, blk)
+		}
+	}
+	if p != nil {
+		blocks = append(blocks, p)
+	}
+	m.Blocks = blocks
+}
+
+// writeInPlace overwrites the metadata at the start of f with blocks followed by pad.
+func writeInPlace(f *os.File, m *Metadata, blocks []*encodedBlock, pad []byte) error {
+	blocks, padding := withPadding(blocks, pad)
+
+	buf := new(bytes.Buffer)
+	if _, err := writeBlocks(buf, blocks); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(buf.Bytes(), 0); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	m.setPadding(padding)
+	return nil
+}
+
+// rewrite writes blocks, pad and the audio frames of the file at path, which
+// start at offset audio, to a temporary file in the same directory and renames
+// it over path.
+func rewrite(path string, audio int64, m *Metadata, blocks []*encodedBlock, pad []byte) (err error) {
+	blocks, padding := withPadding(blocks, pad)
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(path)
+	tmp, err := os.CreateTemp(dir, "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = writeBlocks(tmp, blocks); err != nil {
+		return err
+	}
+	if _, err = src.Seek(audio, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, src); err != nil {
+		return fmt.Errorf("failed to copy audio frames: %v", err)
+	}
+	if err = tmp.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	m.setPadding(padding)
+	return nil
+}
@@ -0,0 +1,120 @@
+package flac
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// copyTestdata copies the named file from testdata into a temporary directory.
+func copyTestdata(t *testing.T, name string) string {
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readMetadataFile(t *testing.T, path string) *Metadata {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m := new(Metadata)
+	if err := m.Read(f); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEditInPlace(t *testing.T) {
+	path := copyTestdata(t, "44100-16-mono.flac")
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Edit(path, func(m *Metadata) error {
+		m.VorbisComment.Data.Comments = append(m.VorbisComment.Data.Comments, "TITLE=In Place")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(orig) {
+		t.Fatalf("file size changed from %d to %d", len(orig), len(got))
+	}
+	audio := metadataLen(t, orig)
+	if !bytes.Equal(got[audio:], orig[audio:]) {
+		t.Error("audio frames changed")
+	}
+
+	m := readMetadataFile(t, path)
+	if c := m.VorbisComment.Data.Comments; len(c) != 2 || c[1] != "TITLE=In Place" {
+		t.Errorf("unexpected comments %q", c)
+	}
+	if got, want := m.Paddings[0].Header.Length, uint32(8175-len("TITLE=In Place")-4); got != want {
+		t.Errorf("padding length = %d, want %d", got, want)
+	}
+}
+
+func TestEditRewrite(t *testing.T) {
+	path := copyTestdata(t, "44100-16-mono.flac")
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Edit(path, func(m *Metadata) error {
+		pic := &Picture{
+			Data: &PictureBlock{
+				PictureType: "Cover (front)",
+				MimeType:    "image/png",
+				PictureBlob: make([]byte, 10000),
+			},
+			IsPopulated: true,
+		}
+		m.Pictures = append(m.Pictures, pic)
+		m.Blocks = append(m.Blocks, pic)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldAudio, newAudio := metadataLen(t, orig), metadataLen(t, got)
+	if !bytes.Equal(got[newAudio:], orig[oldAudio:]) {
+		t.Error("audio frames changed")
+	}
+
+	m := readMetadataFile(t, path)
+	if len(m.Pictures) != 1 || len(m.Pictures[0].Data.PictureBlob) != 10000 {
+		t.Errorf("picture not written: %+v", m.Pictures)
+	}
+	if got := m.Paddings[0].Header.Length; got != DefaultPadding {
+		t.Errorf("padding length = %d, want %d", got, DefaultPadding)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
@@ -0,0 +1,772 @@
+// encode.go - Encoding of PCM samples to FLAC audio frames.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// DefaultCompressionLevel is the compression level used when no
+// EncoderOptions are given, as with the flac tool.
+const DefaultCompressionLevel = 5
+
+// EncoderOptions configures an Encoder.
+type EncoderOptions struct {
+	// Level is the compression level, from 0 (fastest) to 8 (smallest),
+	// trading speed for size like the flac tool's -0 to -8.
+	Level int
+
+	// BlockSize is the number of samples per channel in each frame, from 16
+	// to 65535. 0 selects the block size of Level.
+	BlockSize int
+}
+
+// encoderPreset holds the settings of a compression level.
+type encoderPreset struct {
+	blockSize         int
+	stereo            bool // Try left/side, right/side and mid/side coding.
+	maxLPCOrder       int  // 0 for fixed prediction only.
+	maxPartitionOrder int
+	exhaustive        bool // Try every LPC order rather than the estimated best.
+}
+
+// encoderPresets follow the compression levels of the reference encoder.
+var encoderPresets = [...]encoderPreset{
+	{1152, false, 0, 3, false},
+	{1152, true, 0, 3, false},
+	{1152, true, 0, 3, false},
+	{4096, false, 6, 4, false},
+	{4096, true, 8, 4, false},
+	{4096, true, 8, 5, false},
+	{4096, true, 8, 6, false},
+	{4096, true, 8, 6, true},
+	{4096, true, 12, 6, true},
+}
+
+// Subframe type codes, before the order is added in.
+const (
+	subframeConstant = 0x00
+	subframeVerbatim = 0x01
+	subframeFixed    = 0x08
+	subframeLPC      = 0x20
+)
+
+// Encoder encodes PCM samples to a FLAC stream.
+type Encoder struct {
+	w       io.Writer
+	si      *StreaminfoBlock
+	preset  encoderPreset
+	start   int64 // Position of the stream in w if w is an io.WriteSeeker, or -1.
+	n       int64 // Bytes written.
+	pending []int32
+	frames  uint64
+	md5     hash.Hash
+	md5buf  []byte
+	chans   [][]int64
+	bw      bitWriter
+	err     error
+
+	// variable makes the stream one of variable block size, whose frame
+	// headers give sample numbers, for frames of any size.
+	variable bool
+	minBlock int // Size of the smallest frame but the last.
+	maxBlock int // Size of the largest frame.
+	last     int // Size of the last frame.
+
+	// onFrame, if set, is called with the first sample, the offset in
+	// bytes written and the number of samples of each frame before it is
+	// written.
+	onFrame func(first uint64, off int64, n int)
+}
+
+// NewEncoder writes the signature and the metadata m to w and returns an
+// Encoder that writes audio frames after it. m.Streaminfo.Data must give the
+// stream's SampleRate, Channels and BitsPerSample; NewEncoder sets its block
+// sizes and clears the fields that Close fills in. opts may be nil to use
+// DefaultCompressionLevel.
+func NewEncoder(w io.Writer, m *Metadata, opts *EncoderOptions) (*Encoder, error) {
+	return newEncoder(w, m, opts, false)
+}
+
+// newEncoder is NewEncoder, for a stream of variable block size if variable
+// is set. Until Close fills in the block sizes used, a variable block size
+// stream's STREAMINFO allows any.
+func newEncoder(w io.Writer, m *Metadata, opts *EncoderOptions, variable bool) (*Encoder, error) {
+	si := m.Streaminfo.Data
+	if si == nil {
+		return nil, fmt.Errorf("metadata has no STREAMINFO block")
+	}
+
+	level, blockSize := DefaultCompressionLevel, 0
+	if opts != nil {
+		level, blockSize = opts.Level, opts.BlockSize
+	}
+	if level < 0 || level >= len(encoderPresets) {
+		return nil, fmt.Errorf("invalid compression level %d; must be between 0 and %d", level, len(encoderPresets)-1)
+	}
+	preset := encoderPresets[level]
+	if blockSize == 0 {
+		blockSize = preset.blockSize
+	}
+	if blockSize < 16 || blockSize > 65535 {
+		return nil, fmt.Errorf("invalid block size %d; must be between 16 and 65535", blockSize)
+	}
+
+	si.MinBlockSize, si.MaxBlockSize = uint16(blockSize), uint16(blockSize)
+	if variable {
+		si.MinBlockSize, si.MaxBlockSize = 16, 65535
+	}
+	si.MinFrameSize, si.MaxFrameSize = 0, 0
+	si.TotalSamples, si.MD5Signature = 0, ""
+	m.Streaminfo.IsPopulated = true
+
+	e := &Encoder{
+		w:      w,
+		si:     si,
+		preset: preset,
+		start:  -1,
+		md5:    md5.New(),
+		chans:  make([][]int64, si.Channels),
+
+		variable: variable,
+	}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if off, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			e.start = off
+		}
+	}
+	n, err := m.WriteTo(w)
+	e.n = n
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Write encodes interleaved samples: one sample for each channel in turn.
+// Every sample must fit in the stream's BitsPerSample. A frame is written
+// each time a block fills up; the remainder is kept for the next Write or
+// Close.
+func (e *Encoder) Write(samples []int32) error {
+	if e.err != nil {
+		return e.err
+	}
+	ch := int(e.si.Channels)
+	if len(samples)%ch != 0 {
+		return fmt.Errorf("%d samples do not divide into %d channels", len(samples), ch)
+	}
+	bps := e.si.BitsPerSample
+	lo, hi := int64(-1)<<(bps-1), int64(1)<<(bps-1)-1
+	for i, s := range samples {
+		if int64(s) < lo || int64(s) > hi {
+			return fmt.Errorf("sample %d (%d) does not fit in %d bits", i, s, bps)
+		}
+	}
+
+	e.pending = append(e.pending, samples...)
+	n := int(e.si.MaxBlockSize) * ch
+	off := 0
+	for ; len(e.pending)-off >= n; off += n {
+		if err := e.encodeFrame(e.pending[off : off+n]); err != nil {
+			e.err = err
+			return err
+		}
+	}
+	e.pending = e.pending[:copy(e.pending, e.pending[off:])]
+	return nil
+}
+
+// Close encodes any samples left over as a final, shorter frame and fills in
+// the STREAMINFO frame sizes, TotalSamples and MD5Signature. If the writer
+// passed to NewEncoder is an io.WriteSeeker, the STREAMINFO block at the
+// start of the stream is rewritten; otherwise it keeps the values that mean
+// "unknown". Close does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	e.err = fmt.Errorf("encoder is closed")
+
+	if len(e.pending) > 0 {
+		if err := e.encodeFrame(e.pending); err != nil {
+			return err
+		}
+		e.pending = nil
+	}
+	if e.si.TotalSamples >= StreaminfoTotalSamplesMaximum {
+		e.si.TotalSamples = 0
+	}
+	if e.variable && e.maxBlock != 0 {
+		if e.minBlock == 0 {
+			e.minBlock = e.last
+		}
+		e.si.MinBlockSize, e.si.MaxBlockSize = uint16(e.minBlock), uint16(e.maxBlock)
+	}
+	e.si.MD5Signature = hex.EncodeToString(e.md5.Sum(nil))
+
+	if e.start < 0 {
+		return nil
+	}
+	b, err := e.si.Bytes()
+	if err != nil {
+		return err
+	}
+	ws := e.w.(io.WriteSeeker)
+	if _, err := ws.Seek(e.start+int64(len(FlacSignature))+MetadataBlockHeaderLen/8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(b); err != nil {
+		return err
+	}
+	_, err = ws.Seek(e.start+e.n, io.SeekStart)
+	return err
+}
+
+// encodeFrame encodes interleaved samples as one frame.
+func (e *Encoder) encodeFrame(samples []int32) error {
+	ch := len(e.chans)
+	n := len(samples) / ch
+	bps := uint(e.si.BitsPerSample)
+
+	e.md5buf = appendSamples(e.md5buf[:0], samples, e.si.BitsPerSample)
+	e.md5.Write(e.md5buf)
+
+	for c := range e.chans {
+		if cap(e.chans[c]) < n {
+			e.chans[c] = make([]int64, n)
+		}
+		e.chans[c] = e.chans[c][:n]
+		for i := range e.chans[c] {
+			e.chans[c][i] = int64(samples[i*ch+c])
+		}
+	}
+
+	subframes := make([]*subframe, ch)
+	for c, s := range e.chans {
+		subframes[c] = e.analyze(s, bps)
+	}
+	assignment := ChannelsIndependent
+	if ch == 2 && e.preset.stereo {
+		assignment = e.decorrelate(subframes, bps)
+	}
+
+	if err := e.frameHeader(n, assignment); err != nil {
+		return err
+	}
+	for _, sf := range subframes {
+		sf.write(&e.bw)
+	}
+	e.bw.align()
+	return e.writeFrame(n)
+}
+
+// frameHeader starts the next frame, of n samples, in e.bw.
+func (e *Encoder) frameHeader(n int, assignment ChannelAssignment) error {
+	h := &FrameHeader{
+		BlockSize:         uint32(n),
+		SampleRate:        e.si.SampleRate,
+		Channels:          uint8(len(e.chans)),
+		ChannelAssignment: assignment,
+		BitsPerSample:     e.si.BitsPerSample,
+		Number:            e.frames,
+	}
+	if e.variable {
+		h.VariableBlockSize = true
+		h.Number = e.si.TotalSamples
+	}
+	hdr, err := h.Bytes()
+	if err != nil {
+		return err
+	}
+	e.bw.reset()
+	e.bw.buf = append(e.bw.buf, hdr...)
+	return nil
+}
+
+// writeFrame adds the CRC-16 to the frame of n samples in e.bw and writes it.
+func (e *Encoder) writeFrame(n int) error {
+	if e.onFrame != nil {
+		e.onFrame(e.si.TotalSamples, e.n, n)
+	}
+	crc := crc16(0, e.bw.buf)
+	e.bw.buf = append(e.bw.buf, byte(crc>>8), byte(crc))
+
+	written, err := e.w.Write(e.bw.buf)
+	e.n += int64(written)
+	if err != nil {
+		return err
+	}
+
+	size := uint32(len(e.bw.buf))
+	if e.si.MinFrameSize == 0 || size < e.si.MinFrameSize {
+		e.si.MinFrameSize = size
+	}
+	if size > e.si.MaxFrameSize {
+		e.si.MaxFrameSize = size
+	}
+	e.frames++
+	e.si.TotalSamples += uint64(n)
+	if e.last != 0 && (e.minBlock == 0 || e.last < e.minBlock) {
+		e.minBlock = e.last
+	}
+	if n > e.maxBlock {
+		e.maxBlock = n
+	}
+	e.last = n
+	return nil
+}
+
+// decorrelate replaces the left and right subframes with whichever pair of
+// left, right, mid and side codes smallest and returns the matching channel
+// assignment.
+func (e *Encoder) decorrelate(subframes []*subframe, bps uint) ChannelAssignment {
+	l, r := e.chans[0], e.chans[1]
+	mid, side := make([]int64, len(l)), make([]int64, len(l))
+	for i := range l {
+		mid[i] = (l[i] + r[i]) >> 1
+		side[i] = l[i] - r[i]
+	}
+	left, right := subframes[0], subframes[1]
+	m, s := e.analyze(mid, bps), e.analyze(side, bps+1)
+
+	assignment, best := ChannelsIndependent, left.bits+right.bits
+	if n := left.bits + s.bits; n < best {
+		assignment, best = ChannelsLeftSide, n
+		subframes[0], subframes[1] = left, s
+	}
+	if n := s.bits + right.bits; n < best {
+		assignment, best = ChannelsRightSide, n
+		subframes[0], subframes[1] = s, right
+	}
+	if n := m.bits + s.bits; n < best {
+		assignment = ChannelsMidSide
+		subframes[0], subframes[1] = m, s
+	}
+	return assignment
+}
+
+// subframe is the chosen encoding of one channel of a frame.
+type subframe struct {
+	kind     int
+	order    int
+	wasted   uint    // Number of wasted bits removed from the samples.
+	bps      uint    // Bits per sample, after removing the wasted bits.
+	samples  []int64 // Samples, with the wasted bits removed.
+	coeffs   []int64 // Quantized LPC coefficients.
+	prec     uint    // Precision of the LPC coefficients.
+	shift    int     // Shift of the LPC prediction.
+	residual []int64
+	rice     *riceCode
+	bits     int // Size of the encoded subframe, estimated for predicted subframes.
+}
+
+// analyze chooses the smallest encoding of the channel samples s of bps bits.
+func (e *Encoder) analyze(s []int64, bps uint) *subframe {
+	n := len(s)
+	sf := &subframe{kind: subframeConstant, samples: s, bps: bps, bits: 8 + int(bps)}
+
+	var or int64
+	constant := true
+	for _, v := range s {
+		or |= v
+		constant = constant && v == s[0]
+	}
+	if constant {
+		return sf
+	}
+
+	if tz := uint(bits.TrailingZeros64(uint64(or))); tz > 0 {
+		shifted := make([]int64, n)
+		for i, v := range s {
+			shifted[i] = v >> tz
+		}
+		sf.samples, sf.wasted, sf.bps = shifted, tz, bps-tz
+	}
+	s, bps = sf.samples, sf.bps
+	header := 8 + int(sf.wasted)
+
+	sf.kind, sf.bits = subframeVerbatim, header+n*int(bps)
+
+	for order := 0; order <= 4 && order < n; order++ {
+		res := predictionResidual(s, fixedCoefficients[order], 0)
+		rc := chooseRice(res, order, e.preset.maxPartitionOrder)
+		if rc == nil {
+			continue
+		}
+		if size := header + order*int(bps) + rc.bits; size < sf.bits {
+			sf.kind, sf.order, sf.residual, sf.rice, sf.bits = subframeFixed, order, res, rc, size
+		}
+	}
+
+	maxOrder := e.preset.maxLPCOrder
+	if maxOrder >= n {
+		maxOrder = n - 1
+	}
+	if maxOrder <= 0 {
+		return sf
+	}
+	coeffs, errs := levinson(autocorrelation(tukeyWindow(s), maxOrder))
+	if len(coeffs) == 0 {
+		return sf
+	}
+	prec := lpcPrecision(n, bps)
+	orders := []int{bestLPCOrder(errs, n, bps, prec)}
+	if e.preset.exhaustive {
+		orders = orders[:0]
+		for order := 1; order <= len(coeffs); order++ {
+			orders = append(orders, order)
+		}
+	}
+	for _, order := range orders {
+		q, shift, ok := quantize(coeffs[order-1], prec)
+		if !ok {
+			continue
+		}
+		res := predictionResidual(s, q, uint(shift))
+		rc := chooseRice(res, order, e.preset.maxPartitionOrder)
+		if rc == nil {
+			continue
+		}
+		if size := header + order*int(bps) + 4 + 5 + order*int(prec) + rc.bits; size < sf.bits {
+			sf.kind, sf.order, sf.residual, sf.rice, sf.bits = subframeLPC, order, res, rc, size
+			sf.coeffs, sf.prec, sf.shift = q, prec, shift
+		}
+	}
+	return sf
+}
+
+// predictionResidual returns the residual of predicting s with coeffs and
+// shift, as predict undoes it. The first len(coeffs) warm-up samples are
+// copied unchanged.
+func predictionResidual(s []int64, coeffs []int64, shift uint) []int64 {
+	res := make([]int64, len(s))
+	copy(res, s[:len(coeffs)])
+	for i := len(coeffs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * s[i-j-1]
+		}
+		res[i] = s[i] - sum>>shift
+	}
+	return res
+}
+
+// riceCode is a choice of partition order and Rice parameters for a
+// residual.
+type riceCode struct {
+	porder uint
+	params []uint
+	bits   int // Estimated size, including the coding method and partition order.
+}
+
+// chooseRice picks the partition order, up to maxPorder, and Rice parameters
+// that code the residual res[order:] in the fewest bits. It returns nil if
+// the residual does not fit in 32 bits, as the format requires.
+func chooseRice(res []int64, order, maxPorder int) *riceCode {
+	n := len(res)
+	p := maxPorder
+	for p > 0 && (n%(1<<p) != 0 || n>>p <= order) {
+		p--
+	}
+
+	sums := make([]uint64, 1<<p)
+	size := n >> p
+	for i := order; i < n; i++ {
+		v := res[i]
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil
+		}
+		sums[i/size] += uint64(v<<1 ^ v>>63)
+	}
+
+	var best *riceCode
+	for ; p >= 0; p-- {
+		rc := &riceCode{porder: uint(p), params: make([]uint, len(sums)), bits: 6}
+		paramBits := 4
+		for j, sum := range sums {
+			count := n >> p
+			if j == 0 {
+				count -= order
+			}
+			k, size := riceParam(sum, count)
+			rc.params[j] = k
+			rc.bits += size
+			if k > 14 {
+				paramBits = 5
+			}
+		}
+		rc.bits += len(sums) * paramBits
+		if best == nil || rc.bits < best.bits {
+			best = rc
+		}
+
+		for j := 0; j < len(sums)/2; j++ {
+			sums[j] = sums[2*j] + sums[2*j+1]
+		}
+		sums = sums[:len(sums)/2]
+	}
+	return best
+}
+
+// riceParam estimates the best Rice parameter for count values summing to
+// sum, and the resulting size in bits.
+func riceParam(sum uint64, count int) (uint, int) {
+	if count == 0 {
+		return 0, 0
+	}
+	var guess uint
+	if mean := sum / uint64(count); mean > 0 {
+		guess = uint(bits.Len64(mean)) - 1
+	}
+	bestK, bestBits := uint(0), math.MaxInt
+	for k := guess; k <= guess+1 && k <= 30; k++ {
+		if size := count*int(k+1) + int(sum>>k); size < bestBits {
+			bestK, bestBits = k, size
+		}
+	}
+	if guess > 0 {
+		if size := count*int(guess) + int(sum>>(guess-1)); size < bestBits {
+			bestK, bestBits = guess-1, size
+		}
+	}
+	return bestK, bestBits
+}
+
+// write writes the subframe to bw.
+func (sf *subframe) write(bw *bitWriter) {
+	code := sf.kind
+	switch sf.kind {
+	case subframeFixed:
+		code |= sf.order
+	case subframeLPC:
+		code |= sf.order - 1
+	}
+	var wasted uint64
+	if sf.wasted > 0 {
+		wasted = 1
+	}
+	bw.bits(uint64(code)<<1|wasted, 8)
+	if sf.wasted > 0 {
+		bw.unary(uint64(sf.wasted) - 1)
+	}
+
+	switch sf.kind {
+	case subframeConstant:
+		bw.signed(sf.samples[0], sf.bps)
+		return
+	case subframeVerbatim:
+		for _, v := range sf.samples {
+			bw.signed(v, sf.bps)
+		}
+		return
+	}
+
+	for _, v := range sf.samples[:sf.order] {
+		bw.signed(v, sf.bps)
+	}
+	if sf.kind == subframeLPC {
+		bw.bits(uint64(sf.prec-1), 4)
+		bw.signed(int64(sf.shift), 5)
+		for _, c := range sf.coeffs {
+			bw.signed(c, sf.prec)
+		}
+	}
+	writeResidual(bw, sf.residual, sf.order, sf.rice)
+}
+
+// writeResidual writes res[order:] with the partitioned Rice code rc.
+func writeResidual(bw *bitWriter, res []int64, order int, rc *riceCode) {
+	method, paramBits := uint64(0), uint(4)
+	for _, k := range rc.params {
+		if k > 14 {
+			method, paramBits = 1, 5
+		}
+	}
+	bw.bits(method, 2)
+	bw.bits(uint64(rc.porder), 4)
+
+	size := len(res) >> rc.porder
+	i := order
+	for j, k := range rc.params {
+		bw.bits(uint64(k), paramBits)
+		for end := (j + 1) * size; i < end; i++ {
+			v := res[i]
+			u := uint64(v<<1 ^ v>>63)
+			bw.unary(u >> k)
+			bw.bits(u, k)
+		}
+	}
+}
+
+// Bytes returns the binary encoding of the frame header, ending with its
+// CRC-8. The CRC8 field is ignored. A sample rate or sample size that the
+// header cannot code is left to be taken from STREAMINFO.
+func (h *FrameHeader) Bytes() ([]byte, error) {
+	switch {
+	case h.VariableBlockSize && h.Number >= 1<<36:
+		return nil, fmt.Errorf("invalid sample number %d; must fit in 36 bits", h.Number)
+	case !h.VariableBlockSize && h.Number >= 1<<31:
+		return nil, fmt.Errorf("invalid frame number %d; must fit in 31 bits", h.Number)
+	case h.BlockSize == 0 || h.BlockSize > 65536:
+		return nil, fmt.Errorf("invalid block size %d; must be between 1 and 65536", h.BlockSize)
+	case h.Channels < 1 || h.Channels > 8:
+		return nil, fmt.Errorf("invalid channel count %d; must be between 1 and 8", h.Channels)
+	case h.ChannelAssignment > ChannelsMidSide:
+		return nil, fmt.Errorf("invalid channel assignment %d", h.ChannelAssignment)
+	case h.ChannelAssignment != ChannelsIndependent && h.Channels != 2:
+		return nil, fmt.Errorf("%s channel assignment needs 2 channels, not %d", h.ChannelAssignment, h.Channels)
+	}
+
+	var extra []byte
+
+	var bsCode byte
+	switch n := h.BlockSize; {
+	case n == 192:
+		bsCode = 1
+	case n%576 == 0 && n/576&(n/576-1) == 0 && n <= 4608:
+		bsCode = 2 + byte(bits.TrailingZeros32(n/576))
+	case n%256 == 0 && n/256&(n/256-1) == 0 && n <= 32768:
+		bsCode = 8 + byte(bits.TrailingZeros32(n/256))
+	case n <= 256:
+		bsCode, extra = 6, append(extra, byte(n-1))
+	default:
+		bsCode, extra = 7, append(extra, byte((n-1)>>8), byte(n-1))
+	}
+
+	var srCode byte
+	switch r := h.SampleRate; {
+	case r == 0:
+	case r%1000 == 0 && r/1000 <= 255:
+		srCode = 12
+	case r <= 65535:
+		srCode = 13
+	case r%10 == 0 && r/10 <= 65535:
+		srCode = 14
+	}
+	for code := byte(1); code <= 11; code++ {
+		if frameSampleRates[code] == h.SampleRate {
+			srCode = code
+		}
+	}
+
+	var ssCode byte
+	for code, bps := range frameSampleSizes {
+		if code != 0 && bps == h.BitsPerSample {
+			ssCode = byte(code)
+		}
+	}
+
+	chCode := h.Channels - 1
+	if h.ChannelAssignment != ChannelsIndependent {
+		chCode = 7 + byte(h.ChannelAssignment)
+	}
+
+	b := []byte{0xFF, 0xF8, bsCode<<4 | srCode, chCode<<4 | ssCode<<1}
+	if h.VariableBlockSize {
+		b[1] |= 0x01
+	}
+	b = appendUTF8Number(b, h.Number)
+	b = append(b, extra...)
+	switch r := h.SampleRate; srCode {
+	case 12:
+		b = append(b, byte(r/1000))
+	case 13:
+		b = append(b, byte(r>>8), byte(r))
+	case 14:
+		b = append(b, byte(r/10>>8), byte(r/10))
+	}
+	return append(b, crc8(0, b)), nil
+}
+
+// appendUTF8Number appends n coded like UTF-8 extended to 36 bits, as frame
+// and sample numbers are.
+func appendUTF8Number(b []byte, n uint64) []byte {
+	if n < 0x80 {
+		return append(b, byte(n))
+	}
+	// c continuation bytes of 6 bits each leave 6-c bits in the lead byte.
+	c := uint(1)
+	for c < 6 && n >= 1<<(5*c+6) {
+		c++
+	}
+	b = append(b, byte(0xFF<<(7-c))|byte(n>>(6*c)))
+	for i := int(c) - 1; i >= 0; i-- {
+		b = append(b, 0x80|byte(n>>(6*uint(i)))&0x3F)
+	}
+	return b
+}
+
+// flush encodes the samples left over from Write as a frame of their own.
+// Only a stream of variable block size can have such a frame anywhere but at
+// the end.
+func (e *Encoder) flush() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	err := e.encodeFrame(e.pending)
+	e.pending = e.pending[:0]
+	return err
+}
+
+// copyFrame writes frame, decoded from a stream with the same sample rate,
+// channels and sample size by a Decoder that keeps frame bodies, without
+// encoding its subframes again. Samples left over from Write are flushed
+// first, unless they are too few for a frame of their own, in which case
+// they and the frame's samples are encoded together. Unless the stream has
+// variable block size, frame must be as long as the stream's blocks, and
+// nothing may be left over.
+func (e *Encoder) copyFrame(frame *Frame) error {
+	if e.err != nil {
+		return e.err
+	}
+	ch := len(e.chans)
+	if len(e.pending) > 0 && len(e.pending) < 16*ch || frame.body == nil {
+		e.pending = append(e.pending, frame.Samples...)
+		if n := len(e.pending) / ch; n > 65535 {
+			if err := e.encodeFrame(e.pending[:n/2*ch]); err != nil {
+				e.err = err
+				return err
+			}
+			e.pending = e.pending[:copy(e.pending, e.pending[n/2*ch:])]
+		}
+		if err := e.flush(); err != nil {
+			e.err = err
+			return err
+		}
+		return nil
+	}
+	if err := e.flush(); err != nil {
+		e.err = err
+		return err
+	}
+
+	n := int(frame.Header.BlockSize)
+	e.md5buf = appendSamples(e.md5buf[:0], frame.Samples, e.si.BitsPerSample)
+	e.md5.Write(e.md5buf)
+	err := e.frameHeader(n, frame.Header.ChannelAssignment)
+	if err == nil {
+		e.bw.buf = append(e.bw.buf, frame.body...)
+		err = e.writeFrame(n)
+	}
+	if err != nil {
+		e.err = err
+	}
+	return err
+}
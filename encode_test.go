@@ -0,0 +1,283 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testSignal returns n interleaved samples per channel of a sine sweep with
+// some noise, scaled to bps bits.
+func testSignal(n, channels int, bps uint8) []int32 {
+	rng := rand.New(rand.NewSource(int64(n)))
+	amp := float64(int64(1)<<(bps-1)-1) * 0.7
+	s := make([]int32, n*channels)
+	for i := 0; i < n; i++ {
+		t := float64(i) / 44100
+		for c := 0; c < channels; c++ {
+			v := amp*math.Sin(2*math.Pi*(220+110*float64(c)+50*t)*t) + amp*0.01*rng.NormFloat64()
+			s[i*channels+c] = int32(math.Max(-amp, math.Min(amp, v)))
+		}
+	}
+	return s
+}
+
+// encodeFile encodes samples to a temporary file and returns its contents.
+func encodeFile(t *testing.T, si StreaminfoBlock, opts *EncoderOptions, samples []int32) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := &Metadata{Streaminfo: Streaminfo{Data: &si, IsPopulated: true}}
+	enc, err := NewEncoder(f, m, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write in uneven pieces to exercise the block buffering.
+	for len(samples) > 0 {
+		n := 1000 * int(si.Channels)
+		if n > len(samples) {
+			n = len(samples)
+		}
+		if err := enc.Write(samples[:n]); err != nil {
+			t.Fatal(err)
+		}
+		samples = samples[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// decodeSamples decodes every sample of a FLAC stream.
+func decodeSamples(t *testing.T, b []byte) (*Metadata, []int32) {
+	t.Helper()
+	r := bytes.NewReader(b)
+	m := new(Metadata)
+	if err := m.Read(r); err != nil {
+		t.Fatal(err)
+	}
+	var samples []int32
+	d := NewDecoder(r, m.Streaminfo.Data)
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			return m, samples
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, frame.Samples...)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	noise := func(n int, bps uint8) []int32 {
+		s := make([]int32, n)
+		for i := range s {
+			s[i] = int32(rng.Int63n(1<<bps) - 1<<(bps-1))
+		}
+		return s
+	}
+	wasted := testSignal(5000, 2, 16)
+	for i := range wasted {
+		wasted[i] &^= 0xFF
+	}
+	extremes := make([]int32, 4000)
+	for i := range extremes {
+		if i%2 == 0 {
+			extremes[i] = math.MaxInt32
+		} else {
+			extremes[i] = math.MinInt32
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		channels uint8
+		bps      uint8
+		opts     *EncoderOptions
+		samples  []int32
+	}{
+		{"stereo 16", 2, 16, nil, testSignal(20000, 2, 16)},
+		{"mono 24", 1, 24, &EncoderOptions{Level: 8}, testSignal(10000, 1, 24)},
+		{"5.1 8", 6, 8, &EncoderOptions{Level: 2}, testSignal(3000, 6, 8)},
+		{"odd block size", 2, 16, &EncoderOptions{Level: 5, BlockSize: 1000}, testSignal(4321, 2, 16)},
+		{"silence", 2, 16, nil, make([]int32, 2*5000)},
+		{"noise", 2, 12, &EncoderOptions{Level: 0}, noise(2*5000, 12)},
+		{"wasted bits", 2, 16, nil, wasted},
+		{"32 bit extremes", 2, 32, nil, extremes},
+		{"short", 1, 16, nil, testSignal(10, 1, 16)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			si := StreaminfoBlock{SampleRate: 44100, Channels: tt.channels, BitsPerSample: tt.bps}
+			b := encodeFile(t, si, tt.opts, tt.samples)
+			if err := Verify(bytes.NewReader(b)); err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			m, got := decodeSamples(t, b)
+			if !reflect.DeepEqual(got, tt.samples) {
+				t.Fatal("decoded samples differ from encoded samples")
+			}
+			si = *m.Streaminfo.Data
+			if want := uint64(len(tt.samples) / int(tt.channels)); si.TotalSamples != want {
+				t.Errorf("TotalSamples = %d, want %d", si.TotalSamples, want)
+			}
+			if si.MinFrameSize == 0 || si.MinFrameSize > si.MaxFrameSize {
+				t.Errorf("frame sizes = %d-%d", si.MinFrameSize, si.MaxFrameSize)
+			}
+		})
+	}
+}
+
+func TestEncodeLevels(t *testing.T) {
+	samples := testSignal(30000, 2, 16)
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	var sizes []int
+	for level := 0; level <= 8; level++ {
+		b := encodeFile(t, si, &EncoderOptions{Level: level}, samples)
+		if _, got := decodeSamples(t, b); !reflect.DeepEqual(got, samples) {
+			t.Fatalf("level %d: decoded samples differ from encoded samples", level)
+		}
+		sizes = append(sizes, len(b))
+	}
+	if sizes[8] >= sizes[0] {
+		t.Errorf("level 8 (%d bytes) is no smaller than level 0 (%d bytes)", sizes[8], sizes[0])
+	}
+	if raw := len(samples) * 2; sizes[5] >= raw {
+		t.Errorf("level 5 (%d bytes) is no smaller than the raw samples (%d bytes)", sizes[5], raw)
+	}
+}
+
+func TestEncodeReencode(t *testing.T) {
+	const name = "testdata/44100-16-mono.flac"
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, samples := decodeSamples(t, raw)
+	si := *m.Streaminfo.Data
+	want := si.MD5Signature
+
+	b := encodeFile(t, si, nil, samples)
+	got := new(Metadata)
+	if err := got.Read(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Streaminfo.Data.MD5Signature != want {
+		t.Errorf("MD5 = %s, want %s", got.Streaminfo.Data.MD5Signature, want)
+	}
+	if len(b) >= len(raw)*2 {
+		t.Errorf("re-encoded file is %d bytes, original is %d", len(b), len(raw))
+	}
+}
+
+func TestEncoderStream(t *testing.T) {
+	// A writer that cannot seek keeps STREAMINFO's unknown values.
+	buf := new(bytes.Buffer)
+	m := &Metadata{Streaminfo: Streaminfo{Data: &StreaminfoBlock{SampleRate: 48000, Channels: 1, BitsPerSample: 16}}}
+	enc, err := NewEncoder(buf, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := testSignal(10000, 1, 16)
+	if err := enc.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Streaminfo.Data.TotalSamples != 10000 {
+		t.Errorf("TotalSamples = %d, want 10000", m.Streaminfo.Data.TotalSamples)
+	}
+
+	got, decoded := decodeSamples(t, buf.Bytes())
+	if si := got.Streaminfo.Data; si.TotalSamples != 0 || si.MD5Signature != unsetMD5 {
+		t.Errorf("streamed STREAMINFO has TotalSamples %d, MD5 %s", si.TotalSamples, si.MD5Signature)
+	}
+	if !reflect.DeepEqual(decoded, samples) {
+		t.Error("decoded samples differ from encoded samples")
+	}
+	if err := enc.Write(samples); err == nil {
+		t.Error("Write succeeded after Close")
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	newMetadata := func(si StreaminfoBlock) *Metadata {
+		return &Metadata{Streaminfo: Streaminfo{Data: &si}}
+	}
+	good := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+
+	if _, err := NewEncoder(io.Discard, new(Metadata), nil); err == nil {
+		t.Error("NewEncoder accepted metadata without STREAMINFO")
+	}
+	if _, err := NewEncoder(io.Discard, newMetadata(StreaminfoBlock{SampleRate: 44100, Channels: 9, BitsPerSample: 16}), nil); err == nil {
+		t.Error("NewEncoder accepted 9 channels")
+	}
+	if _, err := NewEncoder(io.Discard, newMetadata(good), &EncoderOptions{Level: 9}); err == nil {
+		t.Error("NewEncoder accepted level 9")
+	}
+	if _, err := NewEncoder(io.Discard, newMetadata(good), &EncoderOptions{BlockSize: 8}); err == nil {
+		t.Error("NewEncoder accepted block size 8")
+	}
+
+	enc, err := NewEncoder(io.Discard, newMetadata(good), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Write([]int32{1, 2, 3}); err == nil {
+		t.Error("Write accepted a partial sample frame")
+	}
+	if err := enc.Write([]int32{0, 1 << 15}); err == nil {
+		t.Error("Write accepted a sample that does not fit in 16 bits")
+	}
+}
+
+func TestFrameHeaderBytes(t *testing.T) {
+	si := &StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16, MaxBlockSize: 4096}
+	for _, h := range []FrameHeader{
+		{BlockSize: 4096, SampleRate: 44100, Channels: 2, ChannelAssignment: ChannelsMidSide, BitsPerSample: 16, Number: 3},
+		{BlockSize: 192, SampleRate: 8000, Channels: 1, BitsPerSample: 8},
+		{BlockSize: 100, SampleRate: 22000, Channels: 8, BitsPerSample: 24, Number: 1<<31 - 1},
+		{BlockSize: 65536, SampleRate: 44101, Channels: 2, ChannelAssignment: ChannelsRightSide, BitsPerSample: 12},
+		{BlockSize: 1000, SampleRate: 123450, Channels: 1, BitsPerSample: 32, VariableBlockSize: true, Number: 1<<36 - 1},
+		{BlockSize: 4608, SampleRate: 44100, Channels: 2, BitsPerSample: 16, Number: 0x7FF},
+	} {
+		b, err := h.Bytes()
+		if err != nil {
+			t.Fatalf("%+v: %v", h, err)
+		}
+		got, err := ReadFrameHeader(bytes.NewReader(b), si)
+		if err != nil {
+			t.Fatalf("%+v: %v", h, err)
+		}
+		h.CRC8 = b[len(b)-1]
+		if !reflect.DeepEqual(*got, h) {
+			t.Errorf("got %+v, want %+v", *got, h)
+		}
+	}
+
+	if _, err := (&FrameHeader{BlockSize: 4096, Channels: 1, ChannelAssignment: ChannelsLeftSide}).Bytes(); err == nil {
+		t.Error("Bytes accepted left/side coding of a mono frame")
+	}
+	if _, err := (&FrameHeader{BlockSize: 4096, Channels: 1, Number: 1 << 31}).Bytes(); err == nil {
+		t.Error("Bytes accepted a frame number that does not fit in 31 bits")
+	}
+}
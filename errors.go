@@ -0,0 +1,95 @@
+// errors.go - Errors returned while parsing FLAC streams.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Parse failures are reported as a *ParseError wrapping one of these errors,
+// so they can be told apart with errors.Is.
+var (
+	// ErrNotFLAC means the stream does not start with the FLAC signature.
+	ErrNotFLAC = errors.New("not a FLAC stream")
+
+	// ErrTruncated means the data ended in the middle of a field.
+	ErrTruncated = errors.New("truncated data")
+
+	// ErrInvalidBlockType means a metadata block header has the invalid
+	// block type 127.
+	ErrInvalidBlockType = errors.New("invalid block type")
+
+	// ErrDuplicateBlock means a block type that may occur only once
+	// (STREAMINFO, SEEKTABLE, VORBIS_COMMENT or CUESHEET) occurred twice.
+	ErrDuplicateBlock = errors.New("duplicate block")
+
+	// ErrInvalidValue means a field holds a value that the format does not
+	// allow.
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrLostSync means an audio frame does not start with the frame sync
+	// code.
+	ErrLostSync = errors.New("frame sync code not found")
+
+	// ErrChecksum means a CRC stored in an audio frame does not match the
+	// frame's contents.
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// ParseError describes where and why parsing failed.
+type ParseError struct {
+	// Type is the type of the block being parsed, or MetadataInvalid if the
+	// failure is outside of any block's data (the FLAC signature, a metadata
+	// block header or an audio frame).
+	Type MetadataBlockType
+
+	// Offset is the byte offset of the field: relative to the start of the
+	// data passed to a Marshal* function, to the start of the stream for
+	// Metadata.Read, or to the start of the frame for audio frames.
+	Offset int64
+
+	// Field names the field that could not be parsed.
+	Field string
+
+	// Err is the cause, which wraps one of the Err* values above or an
+	// I/O error.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Type == MetadataInvalid {
+		return fmt.Sprintf("%s at offset %d: %v", e.Field, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s block: %s at offset %d: %v", e.Type, e.Field, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// invalidValue returns a ParseError for a field of block type typ at offset
+// off that holds a value the format does not allow.
+func invalidValue(typ MetadataBlockType, off int, field, format string, args ...interface{}) error {
+	return &ParseError{
+		Type:   typ,
+		Offset: int64(off),
+		Field:  field,
+		Err:    fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidValue}, args...)...),
+	}
+}
+
+// errNoStreaminfo is returned for a stream without a STREAMINFO block, which
+// Metadata.Read accepts but which cannot be decoded.
+var errNoStreaminfo = fmt.Errorf("%w: no STREAMINFO block", ErrInvalidValue)
@@ -0,0 +1,86 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	raw, err := os.ReadFile("testdata/44100-16-mono.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// STREAMINFO data starts at offset 8, SEEKTABLE's header at 42.
+	const si, st = 8, 42
+
+	mutate := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), raw...))
+	}
+
+	tests := []struct {
+		name   string
+		in     []byte
+		want   error
+		typ    MetadataBlockType
+		offset int64
+	}{
+		{"not FLAC", []byte("RIFF...."), ErrNotFLAC, MetadataInvalid, 0},
+		{"empty", nil, ErrTruncated, MetadataInvalid, 0},
+		{"truncated header", raw[:st+2], ErrTruncated, MetadataInvalid, st},
+		{"truncated block", raw[:st+10], ErrTruncated, MetadataSeektable, st + 10},
+		{"invalid block type", mutate(func(b []byte) []byte {
+			b[st] = 127
+			return b
+		}), ErrInvalidBlockType, MetadataInvalid, st},
+		{"duplicate block", mutate(func(b []byte) []byte {
+			b[st] = byte(MetadataStreaminfo)
+			b[st+3] = 34
+			return b
+		}), ErrDuplicateBlock, MetadataStreaminfo, st},
+		{"invalid value", mutate(func(b []byte) []byte {
+			b[si+2], b[si+3] = 0, 8
+			return b
+		}), ErrInvalidValue, MetadataStreaminfo, si + 2},
+	}
+	for _, tt := range tests {
+		err := new(Metadata).Read(bytes.NewReader(tt.in))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: %T is not a *ParseError", tt.name, err)
+			continue
+		}
+		if pe.Type != tt.typ || pe.Offset != tt.offset {
+			t.Errorf("%s: got %s at offset %d, want %s at offset %d (%v)", tt.name, pe.Type, pe.Offset, tt.typ, tt.offset, err)
+		}
+	}
+}
+
+func TestMarshalParseErrors(t *testing.T) {
+	blocks := rawBlocks(t, "testdata/silence-44-s.flac")
+
+	// The second track starts at offset 395+1+36+12 = 444.
+	cs := append([]byte(nil), blocks[MetadataCuesheet]...)
+	cs[444+8] = 0
+	_, err := MarshalCuesheetBlock(cs)
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("got %v, want a ParseError wrapping ErrInvalidValue", err)
+	}
+	if pe.Type != MetadataCuesheet || pe.Offset != 452 || pe.Field != "track number" {
+		t.Errorf("got %+v, want CUESHEET track number at offset 452", pe)
+	}
+
+	_, err = MarshalPictureBlock(blocks[MetadataPicture][:10])
+	if !errors.As(err, &pe) || !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got %v, want a ParseError wrapping ErrTruncated", err)
+	}
+	if pe.Type != MetadataPicture || pe.Offset != 8 || pe.Field != "MIME type" {
+		t.Errorf("got %+v, want PICTURE MIME type at offset 8", pe)
+	}
+}
@@ -15,8 +15,8 @@
 package flac
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -24,9 +24,10 @@ import (
 // MetadataBlockTypes enumerates types of metadata blocks in a FLAC file.
 type MetadataBlockType uint32
 
-const (
-	FlacSignature = "fLaC"
+// FlacSignature is the stream marker found at the start of every FLAC file.
+const FlacSignature = "fLaC"
 
+const (
 	MetadataStreaminfo MetadataBlockType = iota
 	MetadataPadding
 	MetadataApplication
@@ -85,6 +86,9 @@ const (
 		SeekpointSampleOffsetLen +
 		SeekpointTargetFrameSamplesLen)
 
+	// SeekpointPlaceholder is the SampleNumber of a placeholder point.
+	SeekpointPlaceholder = 0xFFFFFFFFFFFFFFFF
+
 	StreaminfoMinBlockSizeLen  = 16
 	StreaminfoMaxBlockSizeLen  = 16
 	StreaminfoMinFrameSizeLen  = 24
@@ -138,7 +142,9 @@ var PictureTypes = map[uint32]string{
 	20: "Publisher/Studio Logotype",
 }
 
-// HeaderType returns a const representing a MetadataBlockType or Invalid for an unknown/undefined block type.
+// HeaderType returns a const representing a MetadataBlockType. Reserved block
+// types (7-126) are returned as is, for blocks whose contents are unknown to
+// this package; Invalid is returned for 127 and anything out of range.
 func HeaderType(i uint32) MetadataBlockType {
 	switch i {
 	case 0:
@@ -158,6 +164,9 @@ func HeaderType(i uint32) MetadataBlockType {
 	case 127:
 		return MetadataInvalid
 	}
+	if i < 127 {
+		return MetadataBlockType(i)
+	}
 	return MetadataInvalid
 }
 
@@ -170,6 +179,16 @@ func PictureType(k uint32) string {
 	return t
 }
 
+// PictureTypeID looks up the numeric id of a picture type; it is the inverse of PictureType.
+func PictureTypeID(t string) (uint32, error) {
+	for k, v := range PictureTypes {
+		if v == t {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown picture type %q", t)
+}
+
 // String implements the Stringer interface for MetadataBlockTypes.
 func (mbt MetadataBlockType) String() string {
 	switch mbt {
@@ -188,12 +207,15 @@ func (mbt MetadataBlockType) String() string {
 	case MetadataPicture:
 		return "PICTURE"
 	}
+	if mbt < MetadataInvalid {
+		return fmt.Sprintf("UNKNOWN(%d)", uint32(mbt))
+	}
 	return "INVALID"
 }
 
 // Begin base metadata block types.
 
-// Application contains the ID and binary data of an embedded executable. Only one ApplicationBlock is allowed per file.
+// Application contains the ID and binary data of an embedded executable. Multiple Application blocks are allowed per file.
 type ApplicationBlock struct {
 	Id   uint32
 	Data []byte
@@ -207,6 +229,7 @@ type CuesheetBlock struct {
 	TotalTracks        uint8
 	Tracks             []*CuesheetTrack
 	// Reserved           []byte
+	reserved []byte // Reserved bits as read, flags cleared; nil if all zero.
 }
 
 // CuesheetTrack represents an individual cue sheet track.
@@ -219,6 +242,7 @@ type CuesheetTrack struct {
 	// Reserved             []byte // 6 + 13 * 8
 	IndexPoints uint8
 	Indexes     []*TrackIndex
+	reserved    []byte // Reserved bits as read, flags cleared; nil if all zero.
 }
 
 // CuesheetTrackIndex represents the position of a track within the file.
@@ -226,6 +250,7 @@ type TrackIndex struct {
 	SampleOffset uint64
 	IndexPoint   uint8
 	// Reserved     []byte // 3 * 8 bits. All bits must be set to zero.
+	reserved []byte // Reserved bits as read; nil if all zero.
 }
 
 // MetadataBlockHeader is the common element for every metadata block in a
@@ -250,6 +275,8 @@ type PictureBlock struct {
 	NumColors   uint32
 	Length      uint32
 	PictureBlob []byte
+
+	typeID uint32 // Numeric picture type as read, kept for ids PictureType doesn't name.
 }
 
 // Seekpoint contains locations within the FLAC file that allow an application to quickly jump to pre-defined locations in the audio stream.
@@ -272,6 +299,14 @@ type StreaminfoBlock struct {
 	MD5Signature  string
 }
 
+// UnknownBlock contains the raw data of a block whose type is reserved by the
+// FLAC format and unknown to this package. Type is the block type number
+// exactly as it appears in the block header.
+type UnknownBlock struct {
+	Type MetadataBlockType
+	Data []byte
+}
+
 // VorbisComment contains information about the song/audio stream, such as Artist, Song Title, and Album. Only one VorbisCommentBlock is allowed per file.
 type VorbisCommentBlock struct {
 	Vendor        string
@@ -326,6 +361,13 @@ type Streaminfo struct {
 	IsPopulated bool
 }
 
+// Unknown is a full block of a reserved type (header + data).
+type Unknown struct {
+	Header      *MetadataBlockHeader
+	Data        *UnknownBlock
+	IsPopulated bool
+}
+
 // VorbisComment is a full Vorbis Comment block (header + data).
 type VorbisComment struct {
 	Header      *MetadataBlockHeader
@@ -333,16 +375,168 @@ type VorbisComment struct {
 	IsPopulated bool
 }
 
+// Block is implemented by every complete metadata block.
+type Block interface {
+	// BlockHeader returns the header of the block. If the block has no
+	// header yet, one with only the Type field set is returned.
+	BlockHeader() *MetadataBlockHeader
+
+	// Bytes returns the binary encoding of the block, without its header.
+	Bytes() ([]byte, error)
+}
+
+// blockHeader returns h, or a header of type t if h is nil.
+func blockHeader(h *MetadataBlockHeader, t MetadataBlockType) *MetadataBlockHeader {
+	if h == nil {
+		return &MetadataBlockHeader{Type: t}
+	}
+	return h
+}
+
+// BlockHeader implements the Block interface.
+func (a *Application) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(a.Header, MetadataApplication)
+}
+
+// BlockHeader implements the Block interface.
+func (c *Cuesheet) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(c.Header, MetadataCuesheet)
+}
+
+// BlockHeader implements the Block interface.
+func (p *Padding) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(p.Header, MetadataPadding)
+}
+
+// BlockHeader implements the Block interface.
+func (p *Picture) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(p.Header, MetadataPicture)
+}
+
+// BlockHeader implements the Block interface.
+func (s *Seektable) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(s.Header, MetadataSeektable)
+}
+
+// BlockHeader implements the Block interface.
+func (s *Streaminfo) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(s.Header, MetadataStreaminfo)
+}
+
+// BlockHeader implements the Block interface.
+func (u *Unknown) BlockHeader() *MetadataBlockHeader {
+	if u.Header != nil {
+		return u.Header
+	}
+	if u.Data == nil {
+		return blockHeader(nil, MetadataInvalid)
+	}
+	return blockHeader(nil, u.Data.Type)
+}
+
+// BlockHeader implements the Block interface.
+func (v *VorbisComment) BlockHeader() *MetadataBlockHeader {
+	return blockHeader(v.Header, MetadataVorbisComment)
+}
+
 // Metadata represents all metadata present in a FLAC file.
+//
+// Blocks lists every block in the order in which it was read. Its elements
+// point at the same blocks as the typed fields (for the singleton blocks, at
+// the fields themselves), so changes made through either are visible in both.
+// Blocks may be reordered, and blocks inserted or deleted, to change what is
+// written by WriteTo. Blocks added to or removed from the typed fields alone
+// are not reflected in Blocks; set Blocks to nil to have WriteTo write every
+// populated typed field in the canonical order instead.
 type Metadata struct {
 	Streaminfo
-	Application
+	Applications []*Application
 	VorbisComment
 	Pictures []*Picture
-	Padding
+	Paddings []*Padding
 	Seektable
 	Cuesheet
+	Unknowns    []*Unknown
 	TotalBlocks uint8
+	Blocks      []Block
+}
+
+// fieldReader reads the fields of a metadata block of type typ from b.
+// Instead of panicking when b is too short, it records the first error and
+// returns zero values from then on; callers check err once they are done.
+type fieldReader struct {
+	typ MetadataBlockType
+	b   []byte
+	off int
+	err error
+}
+
+func newFieldReader(typ MetadataBlockType, b []byte) *fieldReader {
+	return &fieldReader{typ: typ, b: b}
+}
+
+// len returns the number of unread bytes.
+func (r *fieldReader) len() int {
+	return len(r.b) - r.off
+}
+
+// next returns the next n bytes, or nil if fewer than n bytes are left.
+func (r *fieldReader) next(n int, field string) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.len() {
+		r.err = &ParseError{
+			Type:   r.typ,
+			Offset: int64(r.off),
+			Field:  field,
+			Err:    fmt.Errorf("%w: need %d bytes, %d left", ErrTruncated, n, r.len()),
+		}
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// rest returns all unread bytes.
+func (r *fieldReader) rest() []byte {
+	return r.next(r.len(), "remaining data")
+}
+
+func (r *fieldReader) uint8(field string) uint8 {
+	if b := r.next(1, field); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *fieldReader) uint16(field string) uint16 {
+	if b := r.next(2, field); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *fieldReader) uint32(field string) uint32 {
+	if b := r.next(4, field); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *fieldReader) uint32LE(field string) uint32 {
+	if b := r.next(4, field); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *fieldReader) uint64(field string) uint64 {
+	if b := r.next(8, field); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
 }
 
 // MarshalApplicationBlock marshals b into an ApplicationBlock.
@@ -354,14 +548,16 @@ func MarshalApplicationBlock(b []byte) (*ApplicationBlock, error) {
 	//            |
 	// n          | Application data (n must be a multiple of 8)
 
-	buf := bytes.NewBuffer(b)
+	buf := newFieldReader(MetadataApplication, b)
 	blk := &ApplicationBlock{}
 
-	blk.Id = binary.BigEndian.Uint32(buf.Next(ApplicationIdLen))
-	if buf.Len()%8 != 0 {
-		return nil, fmt.Errorf("malformed ApplictionBlock; field length %d not a multiple of 8", buf.Len())
+	// The remaining data is a whole number of bytes, so it is always a
+	// multiple of 8 bits.
+	blk.Id = buf.uint32("application ID")
+	blk.Data = buf.rest()
+	if buf.err != nil {
+		return nil, buf.err
 	}
-	blk.Data = buf.Bytes()
 	return blk, nil
 }
 
@@ -397,27 +593,32 @@ func MarshalCuesheetBlock(b []byte) (*CuesheetBlock, error) {
 	//            | tracks and one lead-out track).
 
 	const trackType = 0x01
-	buf := bytes.NewBuffer(b)
+	buf := newFieldReader(MetadataCuesheet, b)
 	blk := &CuesheetBlock{}
 
-	blk.MediaCatalogNumber = string(buf.Next(CuesheetMediaCatalogNumberLen / 8))
-	blk.LeadinSamples = binary.BigEndian.Uint64(buf.Next(CuesheetLeadinSamplesLen / 8))
+	blk.MediaCatalogNumber = string(buf.next(CuesheetMediaCatalogNumberLen/8, "media catalog number"))
+	blk.LeadinSamples = buf.uint64("lead-in samples")
 
-	res := buf.Next(CuesheetReservedLen / 8)
+	res := buf.next(CuesheetReservedLen/8, "reserved")
+	off := buf.off
+	blk.TotalTracks = buf.uint8("number of tracks")
+	if buf.err != nil {
+		return nil, buf.err
+	}
 
 	blk.IsCompactDisc = res[0]>>7&trackType == 1
-	blk.TotalTracks = uint8(buf.Next(CuesheetTotalTracksLen / 8)[0])
+	blk.reserved = reservedBits(res, 0x7F)
 	if blk.TotalTracks == 0 {
-		return nil, fmt.Errorf("TotalTracks value must be greater than >= 1")
+		return nil, invalidValue(MetadataCuesheet, off, "number of tracks", "TotalTracks value must be greater than >= 1")
 	}
 
 	for i := 0; i < int(blk.TotalTracks); i++ {
-		track, err := MarshalCuesheetTrack(buf.Next(CuesheetTrackBlockLen / 8))
+		track, err := readCuesheetTrack(buf)
 		if err != nil {
 			return nil, err
 		}
 		for j := 0; j < int(track.IndexPoints); j++ {
-			index, err := MarshalCuesheetTrackIndex(buf.Next(CuesheetTrackIndexBlockLen / 8))
+			index, err := readCuesheetTrackIndex(buf)
 			if err != nil {
 				return nil, err
 			}
@@ -465,23 +666,46 @@ func MarshalCuesheetTrack(b []byte) (*CuesheetTrack, error) {
 	//            | [2] http://en.wikipedia.org/wiki/International_Standard_Recording_Code
 	//            | [3] http://www.chipchapin.com/CDMedia/cdda9.php3
 
-	const trackType = 0x01
-	buf := bytes.NewBuffer(b)
+	return readCuesheetTrack(newFieldReader(MetadataCuesheet, b))
+}
+
+// reservedBits returns a copy of the reserved field res, keeping only the bits
+// of its first byte in mask, so that they can be written back unchanged. It
+// returns nil if none of the remaining bits is set.
+func reservedBits(res []byte, mask byte) []byte {
+	r := append([]byte(nil), res...)
+	r[0] &= mask
+	for _, c := range r {
+		if c != 0 {
+			return r
+		}
+	}
+	return nil
+}
 
+// readCuesheetTrack reads a CuesheetTrack, without its index points, from buf.
+func readCuesheetTrack(buf *fieldReader) (*CuesheetTrack, error) {
+	const trackType = 0x01
 	blk := &CuesheetTrack{}
 
-	blk.Offset = binary.BigEndian.Uint64(buf.Next(CuesheetTrackTrackOffsetLen / 8))
+	blk.Offset = buf.uint64("track offset")
+	off := buf.off
+	blk.Number = buf.uint8("track number")
+	blk.ISRC = string(buf.next(CuesheetTrackTrackISRCLen/8, "track ISRC"))
 
-	if blk.Number = uint8(buf.Next(CuesheetTrackTrackNumberLen / 8)[0]); blk.Number == 0 {
-		return nil, fmt.Errorf("cuesheet track value of 0 is not allowed")
+	// The first byte of the reserved field contain the flags for track type and preemphasis.
+	res := buf.next(CuesheetTrackReservedLen/8, "track flags")
+	blk.IndexPoints = buf.uint8("number of track index points")
+	if buf.err != nil {
+		return nil, buf.err
 	}
-	blk.ISRC = string(buf.Next(CuesheetTrackTrackISRCLen / 8))
 
-	// The first byte of the reserved field contain the flags for track type and preemphasis.
-	res := buf.Next(CuesheetTrackReservedLen / 8)[0]
-	blk.Type = uint8(res >> 7 & trackType)
-	blk.PreEmphasis = res>>6&trackType == 1
-	blk.IndexPoints = uint8(buf.Next(CuesheetTrackIndexPointsLen / 8)[0])
+	if blk.Number == 0 {
+		return nil, invalidValue(MetadataCuesheet, off, "track number", "cuesheet track value of 0 is not allowed")
+	}
+	blk.Type = uint8(res[0] >> 7 & trackType)
+	blk.PreEmphasis = res[0]>>6&trackType == 1
+	blk.reserved = reservedBits(res, 0x3F)
 
 	return blk, nil
 }
@@ -504,14 +728,20 @@ func MarshalCuesheetTrackIndex(b []byte) (*TrackIndex, error) {
 	//            |
 	// 3 * 8      | Reserved. All bits must be set to zero.
 
-	buf := bytes.NewBuffer(b)
+	return readCuesheetTrackIndex(newFieldReader(MetadataCuesheet, b))
+}
+
+// readCuesheetTrackIndex reads a TrackIndex from buf.
+func readCuesheetTrackIndex(buf *fieldReader) (*TrackIndex, error) {
 	blk := &TrackIndex{}
 
-	blk.SampleOffset = binary.BigEndian.Uint64(buf.Next(CuesheetTrackIndexSampleOffsetLen / 8))
-	if blk.SampleOffset%588 != 0 {
-		return nil, fmt.Errorf("invalid value %d for Cuesheet Track Index Sample Offset: must be divisible by 588.", blk.SampleOffset)
+	blk.SampleOffset = buf.uint64("index offset")
+	blk.IndexPoint = buf.uint8("index point number")
+	res := buf.next(CuesheetTrackIndexReservedLen/8, "index reserved")
+	if buf.err != nil {
+		return nil, buf.err
 	}
-	blk.IndexPoint = uint8(buf.Next(CuesheetTrackIndexPointLen / 8)[0])
+	blk.reserved = reservedBits(res, 0xFF)
 	return blk, nil
 }
 
@@ -536,6 +766,13 @@ func MarshalMetadataBlockHeader(b []byte) (*MetadataBlockHeader, error) {
 		blockLen  = 0x00FFFFFF
 	)
 
+	if len(b) < MetadataBlockHeaderLen/8 {
+		return nil, &ParseError{
+			Type:  MetadataInvalid,
+			Field: "metadata block header",
+			Err:   fmt.Errorf("%w: need %d bytes, have %d", ErrTruncated, MetadataBlockHeaderLen/8, len(b)),
+		}
+	}
 	bits := binary.BigEndian.Uint32(b)
 
 	hdr.Last = (lastBlock&bits)>>31 == 1
@@ -544,14 +781,18 @@ func MarshalMetadataBlockHeader(b []byte) (*MetadataBlockHeader, error) {
 	bt := blockType & bits >> 24
 	hdr.Type = HeaderType(bt)
 	if hdr.Type == MetadataInvalid {
-		return nil, fmt.Errorf("invalid or unknown block type: %d", bt)
+		return nil, &ParseError{
+			Type:  MetadataInvalid,
+			Field: "block type",
+			Err:   fmt.Errorf("%w: %d", ErrInvalidBlockType, bt),
+		}
 	}
 
 	return hdr, nil
 }
 
 // MarshalPictureBlock marshals b into a PictureBlock.
-func MarshalPictureBlock(b []byte) *PictureBlock {
+func MarshalPictureBlock(b []byte) (*PictureBlock, error) {
 	// http://flac.sourceforge.net/format.html#metadata_block_picture
 	// Field Len  | Data
 	// -----------+--------------------------------------------------------
@@ -580,36 +821,54 @@ func MarshalPictureBlock(b []byte) *PictureBlock {
 	//            |
 	// n * 8      | The binary picture data.
 
-	buf := bytes.NewBuffer(b)
+	buf := newFieldReader(MetadataPicture, b)
 	blk := &PictureBlock{}
 
-	blk.PictureType = PictureType(binary.BigEndian.Uint32(buf.Next(PictureTypeLen / 8)))
+	blk.typeID = buf.uint32("picture type")
+	blk.PictureType = PictureType(blk.typeID)
 
-	picLength := int(binary.BigEndian.Uint32(buf.Next(PictureMimeLengthLen / 8)))
-	blk.MimeType = string(buf.Next(picLength))
+	picLength := int(buf.uint32("MIME type length"))
+	blk.MimeType = string(buf.next(picLength, "MIME type"))
 
-	picLength = int(binary.BigEndian.Uint32(buf.Next(PictureDescriptionLengthLen / 8)))
+	picLength = int(buf.uint32("description length"))
 	if picLength > 0 {
-		blk.Description = string(buf.Next(picLength))
+		blk.Description = string(buf.next(picLength, "description"))
+	}
+	blk.Width = buf.uint32("width")
+	blk.Height = buf.uint32("height")
+	blk.ColorDepth = buf.uint32("color depth")
+	blk.NumColors = buf.uint32("number of colors")
+	blk.Length = buf.uint32("picture data length")
+
+	blk.PictureBlob = buf.next(int(blk.Length), "picture data")
+	if buf.err != nil {
+		return nil, buf.err
 	}
-	blk.Width = binary.BigEndian.Uint32(buf.Next(PictureWidthLen / 8))
-	blk.Height = binary.BigEndian.Uint32(buf.Next(PictureHeightLen / 8))
-	blk.ColorDepth = binary.BigEndian.Uint32(buf.Next(PictureColorDepthLen / 8))
-	blk.NumColors = binary.BigEndian.Uint32(buf.Next(PictureNumberOfColorsLen / 8))
-	blk.Length = binary.BigEndian.Uint32(buf.Next(PictureLengthLen / 8))
 
-	blk.PictureBlob = buf.Next(int(blk.Length))
+	return blk, nil
+}
 
-	return blk
+// IsPlaceholder reports whether sp is a placeholder point, which reserves
+// space in the table without pointing anywhere.
+func (sp *SeekpointBlock) IsPlaceholder() bool {
+	return sp.SampleNumber == SeekpointPlaceholder
 }
 
-// TotalPoints returns the number of seek points in this Seektable.
-func (s *Seektable) TotalPoints() int {
-	return len(s.Data)
+// TotalPoints returns the number of real seek points in this Seektable and
+// the number of placeholder points.
+func (s *Seektable) TotalPoints() (points, placeholders int) {
+	for _, sp := range s.Data {
+		if sp.IsPlaceholder() {
+			placeholders++
+		} else {
+			points++
+		}
+	}
+	return points, placeholders
 }
 
 // MarshalSeekpointBlock marshals the contents b into a SeektableBlock.
-func MarshalSeekpointBlock(b []byte) []*SeekpointBlock {
+func MarshalSeekpointBlock(b []byte) ([]*SeekpointBlock, error) {
 	// http://flac.sourceforge.net/format.html#seekpoint
 	// Field Len  | Data
 	// -----------+--------------------------------------------------------
@@ -629,15 +888,24 @@ func MarshalSeekpointBlock(b []byte) []*SeekpointBlock {
 	//  - The previous two notes imply that there may be any number of placeholder points,
 	//    but they must all occur at the end of the table.
 
-	buf := bytes.NewBuffer(b)
+	if len(b)%(SeekpointBlockLen/8) != 0 {
+		return nil, invalidValue(MetadataSeektable, 0, "block length", "%d is not a multiple of %d", len(b), SeekpointBlockLen/8)
+	}
+
+	buf := newFieldReader(MetadataSeektable, b)
 	var ret []*SeekpointBlock
 
-	for i := 0; buf.Len() > 0; i++ {
+	for i := 0; buf.len() > 0; i++ {
 		spb := &SeekpointBlock{}
-		binary.Read(buf, binary.BigEndian, spb)
+		spb.SampleNumber = buf.uint64("seek point sample number")
+		spb.Offset = buf.uint64("seek point offset")
+		spb.FrameSamples = buf.uint16("seek point frame samples")
+		if buf.err != nil {
+			return nil, buf.err
+		}
 		ret = append(ret, spb)
 	}
-	return ret
+	return ret, nil
 }
 
 // MarshalStreaminfoBlock marshals b into a StreaminfoBlock.
@@ -682,42 +950,48 @@ func MarshalStreaminfoBlock(b []byte) (*StreaminfoBlock, error) {
 	var bits uint64
 
 	blk := &StreaminfoBlock{}
-	buf := bytes.NewBuffer(b)
+	buf := newFieldReader(MetadataStreaminfo, b)
 
-	blk.MinBlockSize = binary.BigEndian.Uint16(buf.Next(StreaminfoMinBlockSizeLen / 8))
+	blk.MinBlockSize = buf.uint16("minimum block size")
+	if buf.err != nil {
+		return nil, buf.err
+	}
 	if blk.MinBlockSize > 0 && blk.MinBlockSize < 16 {
-		return nil, fmt.Errorf("invalid MinBlockSize '%d'; must be >= 16", blk.MinBlockSize)
+		return nil, invalidValue(MetadataStreaminfo, 0, "minimum block size", "MinBlockSize '%d'; must be >= 16", blk.MinBlockSize)
 	}
 
-	bfsLen := (StreaminfoMaxBlockSizeLen + StreaminfoMinFrameSizeLen + StreaminfoMaxFrameSizeLen) / 8
-	bits = binary.BigEndian.Uint64(buf.Next(bfsLen))
+	bits = buf.uint64("block and frame sizes")
+	if buf.err != nil {
+		return nil, buf.err
+	}
 	blk.MaxBlockSize = uint16((minFSMask & bits) >> 48)
 	if blk.MaxBlockSize < 16 {
-		return nil, fmt.Errorf("invalid MaxBlockSize '%d'; must be > 16", blk.MaxBlockSize)
+		return nil, invalidValue(MetadataStreaminfo, 2, "maximum block size", "MaxBlockSize '%d'; must be > 16", blk.MaxBlockSize)
 	}
 
-	blk.MinFrameSize = uint32((minFSMask & bits) >> 24)
+	blk.MinFrameSize = uint32(bits >> 24 & maxFSMask)
 	blk.MaxFrameSize = uint32(maxFSMask & bits)
 
-	bits = binary.BigEndian.Uint64(buf.Next((StreaminfoSampleRateLen +
-		StreaminfoChannelCountLen +
-		StreaminfoBitsPerSampleLen +
-		StreaminfoTotalSamplesLen) / 8))
+	bits = buf.uint64("sample rate, channels, bits per sample and total samples")
+	md5 := buf.next(StreaminfoMD5Len/8, "MD5 signature")
+	if buf.err != nil {
+		return nil, buf.err
+	}
 
 	blk.SampleRate = uint32((sampRateMask & bits) >> 44)
 	if blk.SampleRate == 0 || blk.SampleRate >= 655350 {
-		return nil, fmt.Errorf("invalid SampleRate '%d'; must be > 0 and < 655350", blk.SampleRate)
+		return nil, invalidValue(MetadataStreaminfo, 10, "sample rate", "SampleRate '%d'; must be > 0 and < 655350", blk.SampleRate)
 	}
 	blk.Channels = uint8((chMask&bits)>>41) + 1
 	blk.BitsPerSample = uint8((bitsPerSampMask&bits)>>36) + 1
 	blk.TotalSamples = bits & totSampMask
-	blk.MD5Signature = fmt.Sprintf("%x", buf.Next(StreaminfoMD5Len/8))
+	blk.MD5Signature = fmt.Sprintf("%x", md5)
 
 	return blk, nil
 }
 
 // MarshalVorbisCommentBlock marshals b into a VorbisCommentBlock.
-func MarshalVorbisCommentBlock(b []byte) *VorbisCommentBlock {
+func MarshalVorbisCommentBlock(b []byte) (*VorbisCommentBlock, error) {
 	// http://www.xiph.org/vorbis/doc/v-comment.html
 	// The comment header is decoded as follows:
 	//
@@ -731,120 +1005,198 @@ func MarshalVorbisCommentBlock(b []byte) *VorbisCommentBlock {
 	// 7) done.
 
 	blk := &VorbisCommentBlock{}
-	buf := bytes.NewBuffer(b)
+	buf := newFieldReader(MetadataVorbisComment, b)
 
-	l := int(binary.LittleEndian.Uint32(buf.Next(VorbisCommentVendorLen / 8)))
-	blk.Vendor = string(buf.Next(l))
-	blk.TotalComments = binary.LittleEndian.Uint32(buf.Next(VorbisCommentUserCommentLen / 8))
+	l := int(buf.uint32LE("vendor length"))
+	blk.Vendor = string(buf.next(l, "vendor string"))
+	blk.TotalComments = buf.uint32LE("number of comments")
 
-	for tc := blk.TotalComments; tc > 0; tc-- {
-		l := int(binary.LittleEndian.Uint32(buf.Next(VorbisCommentCommentLengthLen / 8)))
-		comment := string(buf.Next(l))
+	for tc := blk.TotalComments; tc > 0 && buf.err == nil; tc-- {
+		field := fmt.Sprintf("comment %d", blk.TotalComments-tc)
+		l := int(buf.uint32LE(field + " length"))
+		comment := string(buf.next(l, field))
 		blk.Comments = append(blk.Comments, comment)
 	}
-	return blk
+	if buf.err != nil {
+		return nil, buf.err
+	}
+	return blk, nil
+}
+
+// streaminfo returns the STREAMINFO block of m, or an error wrapping
+// ErrInvalidValue if it has none.
+func (m *Metadata) streaminfo() (*StreaminfoBlock, error) {
+	if m.Streaminfo.Data == nil {
+		return nil, errNoStreaminfo
+	}
+	return m.Streaminfo.Data, nil
+}
+
+// ReadStrict is like Read, but also validates the seek points, the cue sheet
+// and the Vorbis comments. Every violation is reported: the SeektableErrors,
+// CuesheetErrors and VorbisCommentErrors found are joined into one error, from
+// which errors.As extracts each list. m is populated regardless, with the
+// offending entries left in place.
+func (m *Metadata) ReadStrict(f io.Reader) error {
+	if err := m.Read(f); err != nil {
+		return err
+	}
+	var errs []error
+	if m.Seektable.IsPopulated {
+		errs = append(errs, m.Seektable.Validate())
+	}
+	if m.Cuesheet.IsPopulated {
+		errs = append(errs, m.Cuesheet.Data.Validate(m.Streaminfo.Data))
+	}
+	if m.VorbisComment.IsPopulated {
+		errs = append(errs, m.VorbisComment.Data.Validate())
+	}
+	return errors.Join(errs...)
+}
+
+// readError returns a ParseError for a failure to read field at offset off
+// from the stream.
+func readError(typ MetadataBlockType, off int64, field string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return &ParseError{Type: typ, Offset: off, Field: field, Err: err}
 }
 
 // Read reads the metadata from a FLAC file and populates a Metadata struct.
+// Vorbis comments are not validated; malformed comments are kept as is.
+// Parse failures are returned as a *ParseError, with offsets relative to the
+// start of f.
 func (m *Metadata) Read(f io.Reader) error {
 	// First 4 bytes of the file are the FLAC stream marker: 0x66, 0x4C, 0x61, 0x43
 	// It's also the length of all metadata block headers so we'll resue it below.
 	h := make([]byte, MetadataBlockHeaderLen/8)
 
-	n, err := io.ReadFull(f, h)
-	if err != nil || n != int(MetadataBlockHeaderLen/8) {
-		return fmt.Errorf("error reading FLAC signature: %v", err)
+	if _, err := io.ReadFull(f, h); err != nil {
+		return readError(MetadataInvalid, 0, "FLAC signature", err)
 	}
 
 	if string(h) != FlacSignature {
-		return fmt.Errorf("%q is not a valid FLAC signature", h)
+		return &ParseError{
+			Type:  MetadataInvalid,
+			Field: "FLAC signature",
+			Err:   fmt.Errorf("%w: %q is not a valid FLAC signature", ErrNotFLAC, h),
+		}
 	}
+	off := int64(len(h))
 
 	for totalMBH := 0; ; totalMBH++ {
 		// Next 4 bytes after the stream marker is the first metadata block header.
-		n, err := io.ReadFull(f, h)
-		if err != nil || n != int(MetadataBlockHeaderLen/8) {
-			return fmt.Errorf("error reading metadata block header: %v", err)
+		if _, err := io.ReadFull(f, h); err != nil {
+			return readError(MetadataInvalid, off, "metadata block header", err)
 		}
 
 		mbh, err := MarshalMetadataBlockHeader(h)
 		if err != nil {
-			return fmt.Errorf("failed to marshalMetadataBlockHeader: %v", err)
+			if pe, ok := err.(*ParseError); ok {
+				pe.Offset += off
+			}
+			return err
 		}
+		off += int64(len(h))
 
 		block := make([]byte, mbh.Length)
-		n, err = io.ReadFull(f, block)
-		if err != nil {
-			return fmt.Errorf("failed to read %d of %d bytes for %s metadata block: %v", n, mbh.Length, mbh.Type, err)
+		if n, err := io.ReadFull(f, block); err != nil {
+			return readError(mbh.Type, off+int64(n), fmt.Sprintf("block data (%d of %d bytes read)", n, mbh.Length), err)
 		}
 
-		switch mbh.Type {
-		case MetadataStreaminfo:
-			if m.Streaminfo.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
+		if err := m.addBlock(mbh, block); err != nil {
+			if pe, ok := err.(*ParseError); ok {
+				pe.Offset += off
 			}
-			sib, err := MarshalStreaminfoBlock(block)
-			if err != nil {
-				return err
-			}
-			m.Streaminfo = Streaminfo{mbh, sib, true}
-
-		case MetadataVorbisComment:
-			if m.VorbisComment.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
-			}
-			vcb := MarshalVorbisCommentBlock(block)
-			m.VorbisComment = VorbisComment{mbh, vcb, true}
+			return err
+		}
+		off += int64(mbh.Length)
 
-		case MetadataPicture:
-			fpb := MarshalPictureBlock(block)
-			m.Pictures = append(m.Pictures, &Picture{mbh, fpb, true})
+		if mbh.Last {
+			break
+		}
+	}
+	return nil
+}
 
-		case MetadataPadding:
-			if m.Padding.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
-			}
-			m.Padding = Padding{mbh, nil, true}
+// addBlock parses block, whose header is mbh, and adds it to m.
+func (m *Metadata) addBlock(mbh *MetadataBlockHeader, block []byte) error {
+	// The block type is in the header, just before the block data.
+	duplicate := &ParseError{Type: mbh.Type, Offset: -MetadataBlockHeaderLen / 8, Field: "block type", Err: ErrDuplicateBlock}
 
-		case MetadataApplication:
-			if m.Application.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
-			}
-			ab, err := MarshalApplicationBlock(block)
-			if err != nil {
-				return err
-			}
-			m.Application = Application{mbh, ab, true}
+	switch mbh.Type {
+	case MetadataStreaminfo:
+		if m.Streaminfo.IsPopulated {
+			return duplicate
+		}
+		sib, err := MarshalStreaminfoBlock(block)
+		if err != nil {
+			return err
+		}
+		m.Streaminfo = Streaminfo{mbh, sib, true}
+		m.Blocks = append(m.Blocks, &m.Streaminfo)
 
-		case MetadataSeektable:
-			if m.Seektable.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
-			}
-			if len(block)%(SeekpointBlockLen/8) != 0 {
-				return fmt.Errorf("%s block length is not a multiple of %d", mbh.Type, (SeekpointBlockLen / 8))
-			}
+	case MetadataVorbisComment:
+		if m.VorbisComment.IsPopulated {
+			return duplicate
+		}
+		vcb, err := MarshalVorbisCommentBlock(block)
+		if err != nil {
+			return err
+		}
+		m.VorbisComment = VorbisComment{mbh, vcb, true}
+		m.Blocks = append(m.Blocks, &m.VorbisComment)
 
-			st := MarshalSeekpointBlock(block)
-			m.Seektable = Seektable{mbh, st, true}
+	case MetadataPicture:
+		fpb, err := MarshalPictureBlock(block)
+		if err != nil {
+			return err
+		}
+		pic := &Picture{mbh, fpb, true}
+		m.Pictures = append(m.Pictures, pic)
+		m.Blocks = append(m.Blocks, pic)
 
-		case MetadataCuesheet:
-			if m.Cuesheet.IsPopulated {
-				return fmt.Errorf("two %s blocks encountered", mbh.Type)
-			}
+	case MetadataPadding:
+		pad := &Padding{mbh, nil, true}
+		m.Paddings = append(m.Paddings, pad)
+		m.Blocks = append(m.Blocks, pad)
 
-			cb, err := MarshalCuesheetBlock(block)
-			if err != nil {
-				return err
-			}
-			m.Cuesheet = Cuesheet{mbh, cb, true}
+	case MetadataApplication:
+		ab, err := MarshalApplicationBlock(block)
+		if err != nil {
+			return err
+		}
+		app := &Application{mbh, ab, true}
+		m.Applications = append(m.Applications, app)
+		m.Blocks = append(m.Blocks, app)
 
-		default:
-			continue
+	case MetadataSeektable:
+		if m.Seektable.IsPopulated {
+			return duplicate
+		}
+		st, err := MarshalSeekpointBlock(block)
+		if err != nil {
+			return err
 		}
+		m.Seektable = Seektable{mbh, st, true}
+		m.Blocks = append(m.Blocks, &m.Seektable)
 
-		if mbh.Last {
-			break
+	case MetadataCuesheet:
+		if m.Cuesheet.IsPopulated {
+			return duplicate
+		}
+		cb, err := MarshalCuesheetBlock(block)
+		if err != nil {
+			return err
 		}
+		m.Cuesheet = Cuesheet{mbh, cb, true}
+		m.Blocks = append(m.Blocks, &m.Cuesheet)
+
+	default:
+		u := &Unknown{mbh, &UnknownBlock{mbh.Type, block}, true}
+		m.Unknowns = append(m.Unknowns, u)
+		m.Blocks = append(m.Blocks, u)
 	}
 	return nil
 }
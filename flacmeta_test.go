@@ -1,6 +1,7 @@
 package flac
 
 import (
+	"bytes"
 	"encoding/hex"
 	"os"
 	"reflect"
@@ -68,8 +69,8 @@ func TestParseMetadata44k16Mono(t *testing.T) {
 		Data:        nil,
 		IsPopulated: true,
 	}
-	if !reflect.DeepEqual(got.Padding, wantPad) {
-		t.Errorf("Padding differs:\ngot:  %+v\nwant: %+v", got.Padding, wantPad)
+	if !reflect.DeepEqual(got.Paddings, []*Padding{&wantPad}) {
+		t.Errorf("Padding differs:\ngot:  %+v\nwant: %+v", got.Paddings, wantPad)
 	}
 
 	wantSt := Seektable{
@@ -88,8 +89,8 @@ func TestParseMetadata44k16Mono(t *testing.T) {
 	if !reflect.DeepEqual(got.Seektable, wantSt) {
 		t.Errorf("Seektable differs:\ngot:  %+v\nwant: %+v", got.Seektable, wantSt)
 	}
-	if got, want := got.Seektable.TotalPoints(), wantSt.TotalPoints(); got != want {
-		t.Errorf("Seektable TotalPoints differ: got %d, want %d", got, want)
+	if got, _ := got.Seektable.TotalPoints(); got != len(wantSt.Data) {
+		t.Errorf("Seektable TotalPoints differ: got %d, want %d", got, len(wantSt.Data))
 	}
 }
 
@@ -256,6 +257,7 @@ func TestParseMetadata44k16Stereo(t *testing.T) {
 			NumColors:   0,
 			Length:      150,
 			PictureBlob: blob,
+			typeID:      3,
 		},
 		IsPopulated: true,
 	}
@@ -271,7 +273,163 @@ func TestParseMetadata44k16Stereo(t *testing.T) {
 		},
 		IsPopulated: true,
 	}
-	if !reflect.DeepEqual(got.Padding, wantPad) {
-		t.Errorf("Padding differs:\ngot:  %+v\nwant: %+v", got.Padding, wantPad)
+	if !reflect.DeepEqual(got.Paddings, []*Padding{&wantPad}) {
+		t.Errorf("Padding differs:\ngot:  %+v\nwant: %+v", got.Paddings, wantPad)
+	}
+}
+
+func TestParseMetadataUnknownBlock(t *testing.T) {
+	raw, err := os.ReadFile("testdata/44100-16-mono.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Insert a block of reserved type 9 after STREAMINFO.
+	si := len(FlacSignature) + MetadataBlockHeaderLen/8 + 34
+	var b []byte
+	b = append(b, raw[:si]...)
+	b = append(b, 9, 0, 0, 3, 'a', 'b', 'c')
+	b = append(b, raw[si:]...)
+
+	got := new(Metadata)
+	if err := got.Read(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	want := []*Unknown{{
+		Header:      &MetadataBlockHeader{Type: 9, Length: 3},
+		Data:        &UnknownBlock{Type: 9, Data: []byte("abc")},
+		IsPopulated: true,
+	}}
+	if !reflect.DeepEqual(got.Unknowns, want) {
+		t.Errorf("Unknowns differ:\ngot:  %+v\nwant: %+v", got.Unknowns, want)
+	}
+	if got.Blocks[1] != got.Unknowns[0] {
+		t.Errorf("unknown block not second in Blocks: %v", got.Blocks)
+	}
+	if s := got.Unknowns[0].Header.Type.String(); s != "UNKNOWN(9)" {
+		t.Errorf("String() = %q, want %q", s, "UNKNOWN(9)")
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := got.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), b[:buf.Len()]) {
+		t.Error("unknown block not preserved by WriteTo")
+	}
+
+	// Block type 127 is invalid.
+	b[si] = 127
+	if err := new(Metadata).Read(bytes.NewReader(b)); err == nil {
+		t.Error("Read accepted block type 127")
+	}
+
+	// A header set without the data is used as is.
+	h := &MetadataBlockHeader{Type: 9}
+	if got := (&Unknown{Header: h}).BlockHeader(); got != h {
+		t.Errorf("BlockHeader() = %+v, want %+v", got, h)
+	}
+	if got := new(Unknown).BlockHeader().Type; got != MetadataInvalid {
+		t.Errorf("zero Unknown has block type %v, want %v", got, MetadataInvalid)
+	}
+}
+
+// rawBlocks returns the data of every metadata block in the named file, by type.
+func rawBlocks(t testing.TB, name string) map[MetadataBlockType][]byte {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := make(map[MetadataBlockType][]byte)
+	for i := len(FlacSignature); ; {
+		hdr, err := MarshalMetadataBlockHeader(b[i:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		i += MetadataBlockHeaderLen / 8
+		blocks[hdr.Type] = b[i : i+int(hdr.Length)]
+		i += int(hdr.Length)
+		if hdr.Last {
+			return blocks
+		}
+	}
+}
+
+func TestMarshalTruncated(t *testing.T) {
+	blocks := rawBlocks(t, "testdata/silence-44-s.flac")
+	marshalers := map[MetadataBlockType]func([]byte) error{
+		MetadataStreaminfo: func(b []byte) error {
+			_, err := MarshalStreaminfoBlock(b)
+			return err
+		},
+		MetadataSeektable: func(b []byte) error {
+			_, err := MarshalSeekpointBlock(b)
+			return err
+		},
+		MetadataVorbisComment: func(b []byte) error {
+			_, err := MarshalVorbisCommentBlock(b)
+			return err
+		},
+		MetadataCuesheet: func(b []byte) error {
+			_, err := MarshalCuesheetBlock(b)
+			return err
+		},
+		MetadataPicture: func(b []byte) error {
+			_, err := MarshalPictureBlock(b)
+			return err
+		},
+	}
+
+	for typ, marshal := range marshalers {
+		b := blocks[typ]
+		if err := marshal(b); err != nil {
+			t.Errorf("%s: full block: %v", typ, err)
+		}
+		for n := 0; n < len(b); n++ {
+			// A seek table truncated at a seek point boundary is still valid.
+			if typ == MetadataSeektable && n%(SeekpointBlockLen/8) == 0 {
+				continue
+			}
+			if err := marshal(b[:n]); err == nil {
+				t.Errorf("%s: no error for block truncated to %d of %d bytes", typ, n, len(b))
+			}
+		}
+	}
+
+	for _, b := range [][]byte{nil, {0x84, 0, 0}} {
+		if _, err := MarshalMetadataBlockHeader(b); err == nil {
+			t.Errorf("MarshalMetadataBlockHeader(%x) succeeded", b)
+		}
+	}
+	for n := 0; n < ApplicationIdLen/8; n++ {
+		if _, err := MarshalApplicationBlock(make([]byte, n)); err == nil {
+			t.Errorf("MarshalApplicationBlock succeeded with %d bytes", n)
+		}
+	}
+}
+
+func TestMarshalHostileLengths(t *testing.T) {
+	blocks := rawBlocks(t, "testdata/silence-44-s.flac")
+
+	// A CUESHEET claiming 99 tracks, with only the 4 that are present.
+	cs := append([]byte(nil), blocks[MetadataCuesheet]...)
+	cs[CuesheetMediaCatalogNumberLen/8+CuesheetLeadinSamplesLen/8+CuesheetReservedLen/8] = 99
+	if _, err := MarshalCuesheetBlock(cs); err == nil {
+		t.Error("MarshalCuesheetBlock accepted 99 tracks with a short body")
+	}
+
+	// A PICTURE with a 4 GiB MIME type.
+	pic := append([]byte(nil), blocks[MetadataPicture]...)
+	copy(pic[PictureTypeLen/8:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := MarshalPictureBlock(pic); err == nil {
+		t.Error("MarshalPictureBlock accepted a huge MIME type length")
+	}
+
+	// A VORBIS_COMMENT claiming 2^32-1 comments.
+	vc := append([]byte(nil), blocks[MetadataVorbisComment]...)
+	vendor := 4 + int(vc[0])
+	copy(vc[vendor:], []byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := MarshalVorbisCommentBlock(vc); err == nil {
+		t.Error("MarshalVorbisCommentBlock accepted 2^32-1 comments")
 	}
 }
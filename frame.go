@@ -0,0 +1,393 @@
+// frame.go - Parsing of FLAC audio frame headers.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ChannelAssignment describes how the channels of a frame are coded.
+type ChannelAssignment uint8
+
+const (
+	// ChannelsIndependent codes every channel on its own.
+	ChannelsIndependent ChannelAssignment = iota
+	// ChannelsLeftSide codes a stereo frame as left and side (left - right).
+	ChannelsLeftSide
+	// ChannelsRightSide codes a stereo frame as side (left - right) and right.
+	ChannelsRightSide
+	// ChannelsMidSide codes a stereo frame as mid ((left + right) / 2) and side.
+	ChannelsMidSide
+)
+
+const (
+	// FrameSyncCode is the 14 bit code that starts every frame header.
+	FrameSyncCode = 0x3FFE
+
+	// MaxFrameHeaderLen is the length, in bytes, of the longest possible frame header.
+	MaxFrameHeaderLen = 16
+)
+
+// String implements the Stringer interface for ChannelAssignments.
+func (c ChannelAssignment) String() string {
+	switch c {
+	case ChannelsIndependent:
+		return "INDEPENDENT"
+	case ChannelsLeftSide:
+		return "LEFT_SIDE"
+	case ChannelsRightSide:
+		return "RIGHT_SIDE"
+	case ChannelsMidSide:
+		return "MID_SIDE"
+	}
+	return "INVALID"
+}
+
+// FrameHeader is the header of an audio frame. Values that the header takes
+// from STREAMINFO have been filled in.
+type FrameHeader struct {
+	VariableBlockSize bool
+	BlockSize         uint32
+	SampleRate        uint32
+	Channels          uint8
+	ChannelAssignment ChannelAssignment
+	BitsPerSample     uint8
+	// Number is the frame number for fixed block size streams, or the number
+	// of the first sample in the frame for variable block size streams.
+	Number uint64
+	CRC8   uint8
+}
+
+// frameSampleRates maps the sample rate codes of a frame header to sample
+// rates in Hz; 0 means the rate is taken from STREAMINFO or the end of the
+// header.
+var frameSampleRates = [16]uint32{
+	0, 88200, 176400, 192000, 8000, 16000, 22050, 24000,
+	32000, 44100, 48000, 96000, 0, 0, 0, 0,
+}
+
+// frameSampleSizes maps the sample size codes of a frame header to bits per
+// sample; 0 means the size is taken from STREAMINFO or is reserved.
+var frameSampleSizes = [8]uint8{0, 8, 12, 0, 16, 20, 24, 32}
+
+// FirstSample returns the number of the first sample in the frame. For fixed
+// block size streams it is computed from the frame number and the block size
+// in si.
+func (h *FrameHeader) FirstSample(si *StreaminfoBlock) uint64 {
+	if h.VariableBlockSize {
+		return h.Number
+	}
+	return h.Number * uint64(si.MaxBlockSize)
+}
+
+// Check reports whether the header is consistent with si.
+func (h *FrameHeader) Check(si *StreaminfoBlock) error {
+	switch {
+	case h.SampleRate != si.SampleRate:
+		return fmt.Errorf("frame sample rate %d differs from STREAMINFO sample rate %d", h.SampleRate, si.SampleRate)
+	case h.Channels != si.Channels:
+		return fmt.Errorf("frame has %d channels, STREAMINFO has %d", h.Channels, si.Channels)
+	case h.BitsPerSample != si.BitsPerSample:
+		return fmt.Errorf("frame has %d bits per sample, STREAMINFO has %d", h.BitsPerSample, si.BitsPerSample)
+	case h.BlockSize > uint32(si.MaxBlockSize):
+		return fmt.Errorf("frame block size %d exceeds STREAMINFO maximum %d", h.BlockSize, si.MaxBlockSize)
+	}
+	return nil
+}
+
+// frameHeaderReader reads the bytes of a frame header, keeping them for the
+// CRC-8.
+type frameHeaderReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (hr *frameHeaderReader) read(n int, field string) ([]byte, error) {
+	off := len(hr.buf)
+	hr.buf = append(hr.buf, make([]byte, n)...)
+	if _, err := io.ReadFull(hr.r, hr.buf[off:]); err != nil {
+		if err == io.EOF && off == 0 {
+			return nil, io.EOF
+		}
+		return nil, readError(MetadataInvalid, int64(off), field, err)
+	}
+	return hr.buf[off:], nil
+}
+
+// frameError returns a ParseError for an invalid value in a frame header field at offset off.
+func frameError(off int, field, format string, args ...interface{}) error {
+	return invalidValue(MetadataInvalid, off, field, format, args...)
+}
+
+// ReadFrameHeader reads a frame header from r, which must be positioned at
+// the frame's sync code, and verifies its CRC-8. si provides the values that
+// the header defers to STREAMINFO; it may be nil if the header does not
+// need them. io.EOF is returned if r is at the end of the stream.
+func ReadFrameHeader(r io.Reader, si *StreaminfoBlock) (*FrameHeader, error) {
+	// http://flac.sourceforge.net/format.html#frame_header
+	// Field Len  | Data
+	// -----------+--------------------------------------------------------
+	// 14         | Sync code '11111111111110'
+	//            |
+	// 1          | Reserved: must be 0.
+	//            |
+	// 1          | Blocking strategy: 0 for fixed-blocksize, 1 for
+	//            | variable-blocksize.
+	//            |
+	// 4          | Block size in inter-channel samples:
+	//            |   0000 : reserved
+	//            |   0001 : 192 samples
+	//            |   0010-0101 : 576 * (2^(n-2)) samples
+	//            |   0110 : get 8 bit (blocksize-1) from end of header
+	//            |   0111 : get 16 bit (blocksize-1) from end of header
+	//            |   1000-1111 : 256 * (2^(n-8)) samples
+	//            |
+	// 4          | Sample rate: 0000 get from STREAMINFO, 0001-1011 fixed
+	//            | rates, 1100 get 8 bit sample rate (in kHz) from end of
+	//            | header, 1101 get 16 bit sample rate (in Hz), 1110 get 16
+	//            | bit sample rate (in tens of Hz), 1111 invalid.
+	//            |
+	// 4          | Channel assignment: 0000-0111 (n+1) independent channels,
+	//            | 1000 left/side, 1001 right/side, 1010 mid/side, 1011-1111
+	//            | reserved.
+	//            |
+	// 3          | Sample size: 000 get from STREAMINFO, 001 8 bits, 010 12
+	//            | bits, 011 reserved, 100 16 bits, 101 20 bits, 110 24 bits,
+	//            | 111 32 bits.
+	//            |
+	// 1          | Reserved: must be 0.
+	//            |
+	// 8-56       | "UTF-8" coded frame number (fixed-blocksize) or sample
+	//            | number (variable-blocksize).
+	//            |
+	// 0/8/16     | Block size - 1, if the block size code is 0110 or 0111.
+	//            |
+	// 0/8/16     | Sample rate, if the sample rate code is 1100-1110.
+	//            |
+	// 8          | CRC-8 of everything before the crc, including the sync code.
+
+	hr := &frameHeaderReader{r: r}
+	b, err := hr.read(4, "frame header")
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != 0xFF || b[1]&0xFE != 0xF8 {
+		return nil, &ParseError{
+			Type:  MetadataInvalid,
+			Field: "frame sync code",
+			Err:   fmt.Errorf("%w: got %#04x", ErrLostSync, uint16(b[0])<<8|uint16(b[1])),
+		}
+	}
+	h := &FrameHeader{VariableBlockSize: b[1]&0x01 == 1}
+
+	bsCode, srCode := b[2]>>4, b[2]&0x0F
+	chCode, ssCode := b[3]>>4, b[3]>>1&0x07
+	if b[3]&0x01 != 0 {
+		return nil, frameError(3, "reserved bit", "must be 0")
+	}
+
+	switch {
+	case bsCode == 0:
+		return nil, frameError(2, "block size", "reserved block size code 0")
+	case bsCode == 1:
+		h.BlockSize = 192
+	case bsCode <= 5:
+		h.BlockSize = 576 << (bsCode - 2)
+	case bsCode >= 8:
+		h.BlockSize = 256 << (bsCode - 8)
+	}
+
+	switch {
+	case srCode == 0:
+		if si == nil {
+			return nil, frameError(2, "sample rate", "sample rate deferred to missing STREAMINFO")
+		}
+		h.SampleRate = si.SampleRate
+	case srCode == 15:
+		return nil, frameError(2, "sample rate", "invalid sample rate code 15")
+	default:
+		h.SampleRate = frameSampleRates[srCode]
+	}
+
+	switch {
+	case chCode < 8:
+		h.Channels = chCode + 1
+		h.ChannelAssignment = ChannelsIndependent
+	case chCode <= 10:
+		h.Channels = 2
+		h.ChannelAssignment = ChannelAssignment(chCode - 7)
+	default:
+		return nil, frameError(3, "channel assignment", "reserved channel assignment %d", chCode)
+	}
+
+	switch {
+	case ssCode == 0:
+		if si == nil {
+			return nil, frameError(3, "sample size", "sample size deferred to missing STREAMINFO")
+		}
+		h.BitsPerSample = si.BitsPerSample
+	case ssCode == 3:
+		return nil, frameError(3, "sample size", "reserved sample size code 3")
+	default:
+		h.BitsPerSample = frameSampleSizes[ssCode]
+	}
+
+	if h.Number, err = readUTF8Number(hr); err != nil {
+		return nil, err
+	}
+	if !h.VariableBlockSize && h.Number >= 1<<31 {
+		return nil, frameError(4, "frame number", "%d does not fit in 31 bits", h.Number)
+	}
+
+	switch bsCode {
+	case 6:
+		b, err := hr.read(1, "block size")
+		if err != nil {
+			return nil, err
+		}
+		h.BlockSize = uint32(b[0]) + 1
+	case 7:
+		b, err := hr.read(2, "block size")
+		if err != nil {
+			return nil, err
+		}
+		h.BlockSize = (uint32(b[0])<<8 | uint32(b[1])) + 1
+	}
+
+	switch srCode {
+	case 12:
+		b, err := hr.read(1, "sample rate")
+		if err != nil {
+			return nil, err
+		}
+		h.SampleRate = uint32(b[0]) * 1000
+	case 13, 14:
+		b, err := hr.read(2, "sample rate")
+		if err != nil {
+			return nil, err
+		}
+		h.SampleRate = uint32(b[0])<<8 | uint32(b[1])
+		if srCode == 14 {
+			h.SampleRate *= 10
+		}
+	}
+
+	crc := crc8(0, hr.buf)
+	b, err = hr.read(1, "frame header CRC-8")
+	if err != nil {
+		return nil, err
+	}
+	h.CRC8 = b[0]
+	if h.CRC8 != crc {
+		return nil, &ParseError{
+			Type:   MetadataInvalid,
+			Offset: int64(len(hr.buf) - 1),
+			Field:  "frame header CRC-8",
+			Err:    fmt.Errorf("%w: header has %#02x, computed %#02x", ErrChecksum, h.CRC8, crc),
+		}
+	}
+	return h, nil
+}
+
+// readUTF8Number reads a frame or sample number coded like UTF-8 extended to
+// 36 bits, which takes up to 7 bytes.
+func readUTF8Number(hr *frameHeaderReader) (uint64, error) {
+	off := len(hr.buf)
+	b, err := hr.read(1, "frame number")
+	if err != nil {
+		return 0, err
+	}
+
+	var n int // Number of continuation bytes.
+	var v uint64
+	switch c := b[0]; {
+	case c&0x80 == 0:
+		return uint64(c), nil
+	case c&0xE0 == 0xC0:
+		n, v = 1, uint64(c&0x1F)
+	case c&0xF0 == 0xE0:
+		n, v = 2, uint64(c&0x0F)
+	case c&0xF8 == 0xF0:
+		n, v = 3, uint64(c&0x07)
+	case c&0xFC == 0xF8:
+		n, v = 4, uint64(c&0x03)
+	case c&0xFE == 0xFC:
+		n, v = 5, uint64(c&0x01)
+	case c == 0xFE:
+		n, v = 6, 0
+	default:
+		return 0, frameError(off, "frame number", "invalid UTF-8 lead byte %#02x", c)
+	}
+
+	b, err = hr.read(n, "frame number")
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range b {
+		if c&0xC0 != 0x80 {
+			return 0, frameError(off, "frame number", "invalid UTF-8 continuation byte %#02x", c)
+		}
+		v = v<<6 | uint64(c&0x3F)
+	}
+	return v, nil
+}
+
+// NextFrameHeader scans r for the next frame header: a sync code followed by
+// a header that parses, has a valid CRC-8 and is consistent with si. It
+// returns the header and the number of bytes skipped before it; r is left
+// positioned just after the header. Data that happens to look like a valid
+// header can occasionally be found in the middle of a frame, so only frames
+// found by decoding are certain to be real.
+func NextFrameHeader(r *bufio.Reader, si *StreaminfoBlock) (*FrameHeader, int64, error) {
+	skipped, err := skipToFrame(r, si)
+	if err != nil {
+		return nil, skipped, err
+	}
+	h, err := ReadFrameHeader(r, si)
+	return h, skipped, err
+}
+
+// skipToFrame discards bytes from r up to the start of the next frame header
+// that parses, has a valid CRC-8 and is consistent with si, and returns the
+// number of bytes discarded.
+func skipToFrame(r *bufio.Reader, si *StreaminfoBlock) (int64, error) {
+	var skipped int64
+	for {
+		b, err := r.Peek(MaxFrameHeaderLen)
+		if len(b) < 2 {
+			if err == nil {
+				err = io.EOF
+			}
+			return skipped, err
+		}
+
+		if b[0] == 0xFF && b[1]&0xFE == 0xF8 {
+			h, err := ReadFrameHeader(bytes.NewReader(b), si)
+			if err == nil && h.Check(si) == nil {
+				return skipped, nil
+			}
+		}
+
+		// Skip to the next possible start of a sync code.
+		i := bytes.IndexByte(b[1:], 0xFF) + 1
+		if i == 0 {
+			i = len(b)
+		}
+		r.Discard(i)
+		skipped += int64(i)
+	}
+}
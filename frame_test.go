@@ -0,0 +1,128 @@
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// openAudio reads the metadata of a test file and returns it along with the
+// audio frames that follow it.
+func openAudio(t *testing.T, name string) (*Metadata, []byte) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(Metadata)
+	if err := m.Read(bytes.NewReader(raw)); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return m, raw[metadataLen(t, raw):]
+}
+
+func TestReadFrameHeader(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want FrameHeader
+	}{
+		{"testdata/44100-16-mono.flac", FrameHeader{
+			BlockSize:     4096,
+			SampleRate:    44100,
+			Channels:      1,
+			BitsPerSample: 16,
+		}},
+		{"testdata/silence-44-s.flac", FrameHeader{
+			BlockSize:         4608,
+			SampleRate:        44100,
+			Channels:          2,
+			ChannelAssignment: ChannelsIndependent,
+			BitsPerSample:     16,
+		}},
+	} {
+		m, audio := openAudio(t, tt.name)
+		got, err := ReadFrameHeader(bytes.NewReader(audio), m.Streaminfo.Data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got.CRC8 = 0
+		if got.ChannelAssignment != ChannelsIndependent {
+			// Stereo frames may use any decorrelation mode.
+			tt.want.ChannelAssignment = got.ChannelAssignment
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+		if err := got.Check(m.Streaminfo.Data); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestReadFrameHeaderErrors(t *testing.T) {
+	m, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	si := m.Streaminfo.Data
+
+	if _, err := ReadFrameHeader(bytes.NewReader(nil), si); err != io.EOF {
+		t.Errorf("empty input: got %v, want io.EOF", err)
+	}
+
+	hdr := append([]byte(nil), audio[:MaxFrameHeaderLen]...)
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"lost sync", append([]byte{0x00}, hdr[1:]...), ErrLostSync},
+		{"truncated", hdr[:3], ErrTruncated},
+		{"bad crc", func() []byte {
+			b := append([]byte(nil), hdr...)
+			b[4] ^= 0x01 // Frame number 0 becomes 1.
+			return b
+		}(), ErrChecksum},
+		{"reserved sample size", func() []byte {
+			b := append([]byte(nil), hdr...)
+			b[3] = b[3]&^0x0E | 3<<1
+			return b
+		}(), ErrInvalidValue},
+	} {
+		_, err := ReadFrameHeader(bytes.NewReader(tt.b), si)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Type != MetadataInvalid {
+			t.Errorf("%s: got %#v, want a frame ParseError", tt.name, err)
+		}
+	}
+}
+
+func TestNextFrameHeader(t *testing.T) {
+	m, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	si := m.Streaminfo.Data
+
+	r := bufio.NewReader(bytes.NewReader(audio))
+	var samples uint64
+	for n := uint64(0); ; n++ {
+		h, _, err := NextFrameHeader(r, si)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Number != n {
+			t.Fatalf("frame %d has number %d", n, h.Number)
+		}
+		if h.FirstSample(si) != samples {
+			t.Fatalf("frame %d starts at sample %d, want %d", n, h.FirstSample(si), samples)
+		}
+		samples += uint64(h.BlockSize)
+	}
+	if samples != si.TotalSamples {
+		t.Errorf("frames hold %d samples, STREAMINFO says %d", samples, si.TotalSamples)
+	}
+}
@@ -0,0 +1,282 @@
+package flac
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Crashers found by these targets, and inputs that crashed the parsers before
+// they were bounds-checked, are kept in testdata/fuzz, where go test runs them
+// as regular test cases.
+
+// addBlockSeeds adds the data of every block of type typ in testdata to the
+// seed corpus of f.
+func addBlockSeeds(f *testing.F, typ MetadataBlockType) {
+	files, err := filepath.Glob("testdata/*.flac")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		if b, ok := rawBlocks(f, name)[typ]; ok {
+			f.Add(b)
+		}
+	}
+}
+
+func FuzzMetadataRead(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.flac")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m := new(Metadata)
+		if err := m.Read(bytes.NewReader(b)); err != nil {
+			return
+		}
+		out := new(bytes.Buffer)
+		if _, err := m.WriteTo(out); err != nil {
+			return
+		}
+
+		// Whatever was written must read back and write out identically.
+		got := new(Metadata)
+		if err := got.Read(bytes.NewReader(out.Bytes())); err != nil {
+			t.Fatalf("re-reading written metadata: %v", err)
+		}
+		again := new(bytes.Buffer)
+		if _, err := got.WriteTo(again); err != nil {
+			t.Fatalf("re-writing metadata: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), again.Bytes()) {
+			t.Fatalf("metadata changed on round trip:\n%x\n%x", out.Bytes(), again.Bytes())
+		}
+	})
+}
+
+func FuzzMarshalApplicationBlock(f *testing.F) {
+	f.Add([]byte("fooband data"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		blk, err := MarshalApplicationBlock(b)
+		if err != nil {
+			return
+		}
+		out, err := blk.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, b) {
+			t.Fatalf("round trip changed block:\n%x\n%x", b, out)
+		}
+	})
+}
+
+// encoder is implemented by every parsed block type.
+type encoder interface {
+	Bytes() ([]byte, error)
+}
+
+// fuzzBlock fuzzes a block parser: parsing must not panic and a parsed block
+// that can be encoded must parse back to the same value.
+func fuzzBlock(f *testing.F, typ MetadataBlockType, marshal func([]byte) (encoder, error)) {
+	addBlockSeeds(f, typ)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		blk, err := marshal(b)
+		if err != nil {
+			return
+		}
+		out, err := blk.Bytes()
+		if err != nil {
+			return
+		}
+		got, err := marshal(out)
+		if err != nil {
+			t.Fatalf("parsing encoded block: %v", err)
+		}
+		if !reflect.DeepEqual(got, blk) {
+			t.Fatalf("round trip changed block:\ngot:  %+v\nwant: %+v", got, blk)
+		}
+	})
+}
+
+func FuzzMarshalCuesheetBlock(f *testing.F) {
+	fuzzBlock(f, MetadataCuesheet, func(b []byte) (encoder, error) {
+		return MarshalCuesheetBlock(b)
+	})
+}
+
+// Sizes of the parts of a CUESHEET block, in bytes.
+const (
+	cuesheetHeaderLen = (CuesheetMediaCatalogNumberLen + CuesheetLeadinSamplesLen + CuesheetReservedLen + CuesheetTotalTracksLen) / 8
+	cuesheetTrackLen  = (CuesheetTrackTrackOffsetLen + CuesheetTrackTrackNumberLen + CuesheetTrackTrackISRCLen + CuesheetTrackReservedLen + CuesheetTrackIndexPointsLen) / 8
+	cuesheetIndexLen  = CuesheetTrackIndexBlockLen / 8
+)
+
+// addCuesheetSeeds adds the first track, without its index points, or the
+// first index point of the CUESHEET in testdata to the seed corpus of f.
+func addCuesheetSeeds(f *testing.F, index bool) {
+	b := rawBlocks(f, "testdata/silence-44-s.flac")[MetadataCuesheet]
+	off := cuesheetHeaderLen
+	if index {
+		f.Add(b[off+cuesheetTrackLen : off+cuesheetTrackLen+cuesheetIndexLen])
+	} else {
+		f.Add(b[off : off+cuesheetTrackLen])
+	}
+}
+
+// checkCuesheetRoundTrip checks that the CUESHEET block b parses and encodes
+// back to b, and returns it.
+func checkCuesheetRoundTrip(t *testing.T, b []byte) *CuesheetBlock {
+	blk, err := MarshalCuesheetBlock(b)
+	if err != nil {
+		t.Fatalf("parsing cue sheet: %v", err)
+	}
+	out, err := blk.Bytes()
+	if err != nil {
+		t.Fatalf("encoding cue sheet: %v", err)
+	}
+	if !bytes.Equal(out, b) {
+		t.Fatalf("round trip changed cue sheet:\n%x\n%x", b, out)
+	}
+	return blk
+}
+
+func FuzzMarshalCuesheetTrack(f *testing.F) {
+	addCuesheetSeeds(f, false)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		track, err := MarshalCuesheetTrack(b)
+		if err != nil {
+			return
+		}
+
+		// The track must parse the same as the only track of a cue sheet,
+		// with its index points left out, and be written back unchanged.
+		raw := make([]byte, cuesheetHeaderLen, cuesheetHeaderLen+cuesheetTrackLen)
+		raw[cuesheetHeaderLen-1] = 1
+		raw = append(raw, b[:cuesheetTrackLen]...)
+		raw[len(raw)-1] = 0
+		blk := checkCuesheetRoundTrip(t, raw)
+		want := *track
+		want.IndexPoints = 0
+		if !reflect.DeepEqual(blk.Tracks[0], &want) {
+			t.Fatalf("track differs in a cue sheet:\ngot:  %+v\nwant: %+v", blk.Tracks[0], &want)
+		}
+	})
+}
+
+func FuzzMarshalCuesheetTrackIndex(f *testing.F) {
+	addCuesheetSeeds(f, true)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		idx, err := MarshalCuesheetTrackIndex(b)
+		if err != nil {
+			return
+		}
+
+		// The index point must parse the same as the only index point of
+		// track 1 of a cue sheet, and be written back unchanged.
+		raw := make([]byte, cuesheetHeaderLen+cuesheetTrackLen, cuesheetHeaderLen+cuesheetTrackLen+cuesheetIndexLen)
+		raw[cuesheetHeaderLen-1] = 1
+		raw[cuesheetHeaderLen+CuesheetTrackTrackOffsetLen/8] = 1
+		raw[len(raw)-1] = 1
+		raw = append(raw, b[:cuesheetIndexLen]...)
+		blk := checkCuesheetRoundTrip(t, raw)
+		if got := blk.Tracks[0].Indexes[0]; !reflect.DeepEqual(got, idx) {
+			t.Fatalf("index point differs in a cue sheet:\ngot:  %+v\nwant: %+v", got, idx)
+		}
+	})
+}
+
+func FuzzMarshalPictureBlock(f *testing.F) {
+	fuzzBlock(f, MetadataPicture, func(b []byte) (encoder, error) {
+		return MarshalPictureBlock(b)
+	})
+}
+
+func FuzzMarshalStreaminfoBlock(f *testing.F) {
+	fuzzBlock(f, MetadataStreaminfo, func(b []byte) (encoder, error) {
+		return MarshalStreaminfoBlock(b)
+	})
+}
+
+func FuzzMarshalVorbisCommentBlock(f *testing.F) {
+	fuzzBlock(f, MetadataVorbisComment, func(b []byte) (encoder, error) {
+		return MarshalVorbisCommentBlock(b)
+	})
+}
+
+func FuzzMarshalSeekpointBlock(f *testing.F) {
+	addBlockSeeds(f, MetadataSeektable)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		points, err := MarshalSeekpointBlock(b)
+		if err != nil {
+			return
+		}
+		st := &Seektable{Data: points}
+		out, err := st.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, b) {
+			t.Fatalf("round trip changed block:\n%x\n%x", b, out)
+		}
+	})
+}
+
+func FuzzMarshalMetadataBlockHeader(f *testing.F) {
+	f.Add([]byte{0x84, 0x00, 0x00, 0x39})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		hdr, err := MarshalMetadataBlockHeader(b)
+		if err != nil {
+			return
+		}
+		out, err := hdr.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, b[:len(out)]) {
+			t.Fatalf("round trip changed header: %x, %x", b, out)
+		}
+	})
+}
+
+func FuzzDecoder(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.flac")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r := bytes.NewReader(b)
+		m := new(Metadata)
+		if err := m.Read(r); err != nil {
+			return
+		}
+		d := NewDecoder(r, m.Streaminfo.Data)
+		for {
+			frame, err := d.Next()
+			if frame == nil && err != nil {
+				return
+			}
+			if len(frame.Samples) != int(frame.Header.BlockSize)*int(frame.Header.Channels) {
+				t.Fatalf("frame has %d samples, want %d", len(frame.Samples), int(frame.Header.BlockSize)*int(frame.Header.Channels))
+			}
+		}
+	})
+}
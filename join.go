@@ -0,0 +1,301 @@
+// join.go - Joining FLAC streams into one image with a CUESHEET.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+)
+
+// DefaultSeekInterval is the time between the seek points of a joined image.
+const DefaultSeekInterval = 10 * time.Second
+
+// JoinOptions are the options for Join. The zero value re-encodes at
+// DefaultCompressionLevel and puts seek points every DefaultSeekInterval.
+type JoinOptions struct {
+	// Encoder gives the compression level of re-encoded frames; its
+	// BlockSize is ignored. nil means DefaultCompressionLevel.
+	Encoder *EncoderOptions
+
+	// SeekInterval is the time between seek points; 0 means
+	// DefaultSeekInterval.
+	SeekInterval time.Duration
+}
+
+// joinComments merges the Vorbis comments of the tracks vcs, any of which may
+// be nil. Fields with the same values in every track are kept as they are;
+// other fields are given for each track with its number in brackets, such as
+// TITLE[2]. The track numbers and totals are left out, and the ALBUM also
+// becomes the TITLE, if there is none.
+func joinComments(vcs []*VorbisCommentBlock) *VorbisCommentBlock {
+	var out *VorbisCommentBlock
+	var fields []string
+	seen := make(map[string]bool)
+	for _, vc := range vcs {
+		if vc == nil {
+			continue
+		}
+		if out == nil {
+			out = &VorbisCommentBlock{Vendor: vc.Vendor}
+		}
+		for _, field := range vc.Fields() {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	if out == nil {
+		return nil
+	}
+
+	for _, field := range fields {
+		if field == "TRACKNUMBER" || field == "TRACKTOTAL" || field == "TOTALTRACKS" {
+			continue
+		}
+		values := make([][]string, len(vcs))
+		common := true
+		for i, vc := range vcs {
+			if vc != nil {
+				values[i] = vc.Get(field)
+			}
+			common = common && reflect.DeepEqual(values[i], values[0])
+		}
+		for i, vs := range values {
+			for _, v := range vs {
+				if common {
+					out.Comments = append(out.Comments, field+"="+v)
+				} else {
+					out.Comments = append(out.Comments, fmt.Sprintf("%s[%d]=%s", field, i+1, v))
+				}
+			}
+			if common {
+				break
+			}
+		}
+	}
+	out.TotalComments = uint32(len(out.Comments))
+	if out.Get("TITLE") == nil {
+		if album := out.Get("ALBUM"); album != nil {
+			out.Set("TITLE", album...)
+		}
+	}
+	return out
+}
+
+// Join concatenates the FLAC streams read from srcs, which must have the same
+// sample rate, channels and sample size and give their lengths in STREAMINFO,
+// into one stream written to w, such as a gapless album image, and returns
+// its metadata. The image has a CUESHEET with a track for each stream, which
+// is a CD-DA cue sheet if the streams are CD audio that starts and ends on
+// CD frames;
+// Vorbis comments merged from the streams, those that differ between tracks
+// given with the track number in brackets, such as TITLE[2], and ISRCs moved
+// to the cue sheet; the pictures of the first stream; and a SEEKTABLE.
+//
+// The frames of the streams are copied without being encoded again, which
+// gives a stream of variable block size; only a frame too short to stand
+// alone within the image is encoded again, together with the next.
+func Join(w io.WriteSeeker, srcs []io.Reader, opts *JoinOptions) (*Metadata, error) {
+	if opts == nil {
+		opts = new(JoinOptions)
+	}
+	if len(srcs) == 0 || len(srcs) >= LeadoutTrack {
+		return nil, fmt.Errorf("cannot join %d streams; must be between 1 and %d", len(srcs), LeadoutTrack-1)
+	}
+
+	ms := make([]*Metadata, len(srcs))
+	ds := make([]*Decoder, len(srcs))
+	var total uint64
+	for i, r := range srcs {
+		m, d, err := Open(r)
+		if err != nil {
+			return nil, fmt.Errorf("stream %d: %w", i+1, err)
+		}
+		si, first := m.Streaminfo.Data, ms[0]
+		if first != nil {
+			if f := first.Streaminfo.Data; si.SampleRate != f.SampleRate || si.Channels != f.Channels || si.BitsPerSample != f.BitsPerSample {
+				return nil, fmt.Errorf("stream %d has %d bit %d channel audio at %dHz, stream 1 has %d bit %d channel audio at %dHz",
+					i+1, si.BitsPerSample, si.Channels, si.SampleRate, f.BitsPerSample, f.Channels, f.SampleRate)
+			}
+		}
+		if si.TotalSamples == 0 {
+			return nil, fmt.Errorf("stream %d has an unknown number of samples", i+1)
+		}
+		d.br.keep = true
+		ms[i], ds[i] = m, d
+		total += si.TotalSamples
+	}
+	si := ms[0].Streaminfo.Data
+
+	// One track per stream, with its ISRC taken from the comments.
+	cs := &CuesheetBlock{IsCompactDisc: isCDDA(si) && len(srcs) < 100}
+	vcs := make([]*VorbisCommentBlock, len(srcs))
+	var offset uint64
+	for i, m := range ms {
+		if offset%CDSamplesPerFrame != 0 {
+			cs.IsCompactDisc = false
+		}
+		t := &CuesheetTrack{Offset: offset, Number: uint8(i + 1), IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}}
+		if m.VorbisComment.IsPopulated {
+			vc := *m.VorbisComment.Data
+			if isrc := vc.First("ISRC"); len(isrc) == CuesheetTrackTrackISRCLen/8 && isAlnum(isrc) && len(vc.Get("ISRC")) == 1 {
+				t.ISRC = isrc
+				vc.Delete("ISRC")
+			}
+			vcs[i] = &vc
+		}
+		cs.Tracks = append(cs.Tracks, t)
+		offset += m.Streaminfo.Data.TotalSamples
+	}
+	if total%CDSamplesPerFrame != 0 {
+		cs.IsCompactDisc = false
+	}
+	leadout := &CuesheetTrack{Offset: total, Number: LeadoutTrack}
+	if cs.IsCompactDisc {
+		cs.LeadinSamples = 2 * 44100
+		leadout.Number = CDLeadoutTrack
+	}
+	cs.Tracks = append(cs.Tracks, leadout)
+	cs.TotalTracks = uint8(len(cs.Tracks))
+
+	// The seek points are only known once the audio is written, so the
+	// SEEKTABLE starts out with placeholders that take their place.
+	d := opts.SeekInterval
+	if d == 0 {
+		d = DefaultSeekInterval
+	}
+	interval, err := seekInterval(si, d)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]*SeekpointBlock, (total+interval-1)/interval)
+	for i := range points {
+		points[i] = &SeekpointBlock{SampleNumber: SeekpointPlaceholder}
+	}
+
+	m := &Metadata{
+		Streaminfo: Streaminfo{Data: &StreaminfoBlock{
+			SampleRate:    si.SampleRate,
+			Channels:      si.Channels,
+			BitsPerSample: si.BitsPerSample,
+		}},
+		Pictures: ms[0].Pictures,
+	}
+	m.SetSeektable(points)
+	m.SetCuesheet(cs)
+	if vc := joinComments(vcs); vc != nil {
+		m.VorbisComment = VorbisComment{Data: vc, IsPopulated: true}
+	}
+
+	encOpts := EncoderOptions{Level: DefaultCompressionLevel, BlockSize: int(si.MaxBlockSize)}
+	if opts.Encoder != nil {
+		encOpts.Level = opts.Encoder.Level
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := newEncoder(w, m, &encOpts, true)
+	if err != nil {
+		return nil, err
+	}
+	audio := enc.n
+	sp := &seekpoints{interval: interval}
+	enc.onFrame = func(first uint64, off int64, n int) {
+		sp.add(first, off-audio, n)
+	}
+
+	for i, d := range ds {
+		var n uint64
+		for {
+			frame, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("stream %d: %w", i+1, err)
+			}
+			n += uint64(frame.Header.BlockSize)
+			if frame.Header.BlockSize < 16 {
+				err = enc.Write(frame.Samples)
+			} else {
+				err = enc.copyFrame(frame)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if want := ms[i].Streaminfo.Data.TotalSamples; n != want {
+			return nil, fmt.Errorf("stream %d has %d samples, STREAMINFO says %d", i+1, n, want)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the metadata with the seek points, which takes the same
+	// space as before.
+	copy(points, sp.points)
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != audio {
+		return nil, fmt.Errorf("metadata changed size from %d to %d bytes", audio, buf.Len())
+	}
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if _, err := w.Seek(start+enc.n, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// JoinFiles joins the FLAC files srcs like Join, writing the image to a new
+// file at dst. The file is removed if Join fails.
+func JoinFiles(dst string, srcs []string, opts *JoinOptions) (err error) {
+	readers := make([]io.Reader, len(srcs))
+	for i, src := range srcs {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	_, err = Join(f, readers, opts)
+	return err
+}
@@ -0,0 +1,219 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTracks encodes each of tracks, given as sample counts, to a file in
+// dir with the Vorbis comments given for it, and returns the file names and
+// all the samples.
+func writeTracks(t *testing.T, dir string, si StreaminfoBlock, lengths []int, comments [][]string) ([]string, []int32) {
+	t.Helper()
+	var names []string
+	var all []int32
+	for i, n := range lengths {
+		samples := testSignal(n, int(si.Channels), si.BitsPerSample)
+		all = append(all, samples...)
+		s := si
+		m := &Metadata{Streaminfo: Streaminfo{Data: &s}}
+		if comments[i] != nil {
+			m.VorbisComment = VorbisComment{Data: &VorbisCommentBlock{Vendor: "test", Comments: comments[i]}, IsPopulated: true}
+		}
+		name := filepath.Join(dir, strings.Repeat("x", i+1)+".flac")
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, err := NewEncoder(f, m, &EncoderOptions{BlockSize: 4096})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Write(samples); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		names = append(names, name)
+	}
+	return names, all
+}
+
+func TestJoin(t *testing.T) {
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	dir := t.TempDir()
+	// The first track ends with a frame of 12 samples.
+	lengths := []int{209 * 588, 100 * 588, 21 * 588}
+	names, samples := writeTracks(t, dir, si, lengths, [][]string{
+		{"ALBUM=Album", "ARTIST=Someone", "TITLE=One", "TRACKNUMBER=1"},
+		{"ALBUM=Album", "ARTIST=Someone", "TITLE=Two", "TRACKNUMBER=2", "ISRC=USABC1234567"},
+		{"ALBUM=Album", "ARTIST=Guest", "TITLE=Three", "TRACKNUMBER=3"},
+	})
+
+	image := filepath.Join(dir, "image.flac")
+	if err := JoinFiles(image, names, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bytes.NewReader(b)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := new(Metadata).ReadStrict(bytes.NewReader(b)); err != nil {
+		t.Errorf("ReadStrict: %v", err)
+	}
+	m, got := decodeSamples(t, b)
+	if !reflect.DeepEqual(got, samples) {
+		t.Error("joined samples differ")
+	}
+
+	wantComments := []string{"ALBUM=Album", "ARTIST[1]=Someone", "ARTIST[2]=Someone", "ARTIST[3]=Guest",
+		"TITLE[1]=One", "TITLE[2]=Two", "TITLE[3]=Three", "TITLE=Album"}
+	if got := m.VorbisComment.Data.Comments; !reflect.DeepEqual(got, wantComments) {
+		t.Errorf("comments = %q, want %q", got, wantComments)
+	}
+
+	cs := m.Cuesheet.Data
+	trimCuesheet(cs)
+	wantCs := &CuesheetBlock{
+		LeadinSamples: 88200,
+		IsCompactDisc: true,
+		TotalTracks:   4,
+		Tracks: []*CuesheetTrack{
+			{Number: 1, IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 209 * 588, Number: 2, ISRC: "USABC1234567", IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 309 * 588, Number: 3, IndexPoints: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 330 * 588, Number: CDLeadoutTrack},
+		},
+	}
+	if !reflect.DeepEqual(cs, wantCs) {
+		t.Errorf("cue sheet = %+v, want %+v", cs, wantCs)
+	}
+
+	r := bytes.NewReader(b[audioStart(t, b):])
+	points, err := BuildSeektableEvery(r, m.Streaminfo.Data, DefaultSeekInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Seektable.Data, points) {
+		t.Errorf("seek points = %v, want %v", m.Seektable.Data, points)
+	}
+
+	// Splitting the image gives back the tracks.
+	out := t.TempDir()
+	split, err := SplitFile(image, out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := 0
+	for i, name := range split {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, got := decodeSamples(t, b)
+		n := 2 * lengths[i]
+		if !reflect.DeepEqual(got, samples[off:off+n]) {
+			t.Errorf("track %d samples differ", i+1)
+		}
+		off += n
+		if title := m.VorbisComment.Data.First("TITLE"); title != []string{"One", "Two", "Three"}[i] {
+			t.Errorf("track %d TITLE = %q", i+1, title)
+		}
+	}
+}
+
+func TestJoinNotCD(t *testing.T) {
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	dir := t.TempDir()
+	names, samples := writeTracks(t, dir, si, []int{5000, 7000}, [][]string{nil, nil})
+	out, err := os.Create(filepath.Join(dir, "image.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	readers := []*os.File{}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	m, err := Join(out, []io.Reader{readers[0], readers[1]}, &JoinOptions{SeekInterval: DefaultSeekInterval / 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.VorbisComment.IsPopulated {
+		t.Error("image has Vorbis comments that the tracks do not")
+	}
+	cs := m.Cuesheet.Data
+	if cs.IsCompactDisc || cs.LeadinSamples != 0 || cs.Tracks[2].Number != LeadoutTrack {
+		t.Errorf("cue sheet = %+v", cs)
+	}
+	if len(m.Seektable.Data) != 3 {
+		t.Errorf("got %d seek points, want 3", len(m.Seektable.Data))
+	}
+
+	b, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got := decodeSamples(t, b); !reflect.DeepEqual(got, samples) {
+		t.Error("joined samples differ")
+	}
+
+	// Tracks that start on CD frames, in an image that does not end on one.
+	names, _ = writeTracks(t, t.TempDir(), si, []int{3 * CDSamplesPerFrame, 1000}, [][]string{nil, nil})
+	image := filepath.Join(dir, "odd.flac")
+	if err := JoinFiles(image, names, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m = new(Metadata)
+	if err := m.ReadStrict(f); err != nil {
+		t.Fatal(err)
+	}
+	if m.Cuesheet.Data.IsCompactDisc {
+		t.Error("image that does not end on a CD frame has a CD-DA cue sheet")
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	dir := t.TempDir()
+	a, _ := writeTracks(t, dir, StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, []int{1000}, [][]string{nil})
+	b, _ := writeTracks(t, t.TempDir(), StreaminfoBlock{SampleRate: 48000, Channels: 2, BitsPerSample: 16}, []int{1000}, [][]string{nil})
+	dst := filepath.Join(dir, "image.flac")
+	if err := JoinFiles(dst, append(a, b...), nil); err == nil {
+		t.Error("JoinFiles accepted streams with different sample rates")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("JoinFiles left %s behind", dst)
+	}
+	if err := JoinFiles(dst, nil, nil); err == nil {
+		t.Error("JoinFiles accepted no streams")
+	}
+
+	src := filepath.Join(dir, "no-streaminfo.flac")
+	if err := os.WriteFile(src, noStreaminfo(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := JoinFiles(dst, append(a, src), nil); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("stream without STREAMINFO: got %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,175 @@
+// lpc.go - Linear prediction analysis for the encoder.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import "math"
+
+// MaxLPCOrder is the highest LPC predictor order the format allows.
+const MaxLPCOrder = 32
+
+// tukeyWindow applies a Tukey window with a taper of half its length to s.
+func tukeyWindow(s []int64) []float64 {
+	n := len(s)
+	x := make([]float64, n)
+	taper := n / 4
+	for i, v := range s {
+		w := 1.0
+		switch {
+		case i < taper:
+			w = 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(taper))
+		case i >= n-taper:
+			w = 0.5 - 0.5*math.Cos(math.Pi*float64(n-1-i)/float64(taper))
+		}
+		x[i] = float64(v) * w
+	}
+	return x
+}
+
+// autocorrelation returns the autocorrelation of x for lags 0 through
+// maxLag.
+func autocorrelation(x []float64, maxLag int) []float64 {
+	r := make([]float64, maxLag+1)
+	for lag := range r {
+		var sum float64
+		for i := lag; i < len(x); i++ {
+			sum += x[i] * x[i-lag]
+		}
+		r[lag] = sum
+	}
+	return r
+}
+
+// levinson solves for the predictor coefficients of every order from 1 to
+// len(r)-1 with the Levinson-Durbin recursion. coeffs[k-1] holds the k
+// coefficients of order k, which predict x[i] as the sum of coeffs[k-1][j] *
+// x[i-j-1]; errs[k-1] is the prediction error energy of order k. Orders whose
+// error would not be positive are left out.
+func levinson(r []float64) (coeffs [][]float64, errs []float64) {
+	if len(r) < 2 || r[0] <= 0 {
+		return nil, nil
+	}
+	lpc := make([]float64, len(r)-1)
+	prev := make([]float64, len(r)-1)
+	e := r[0]
+	for i := 0; i < len(r)-1; i++ {
+		acc := r[i+1]
+		for j := 0; j < i; j++ {
+			acc -= lpc[j] * r[i-j]
+		}
+		k := acc / e
+
+		copy(prev, lpc[:i])
+		lpc[i] = k
+		for j := 0; j < i; j++ {
+			lpc[j] = prev[j] - k*prev[i-1-j]
+		}
+		e *= 1 - k*k
+		if e <= 0 || math.IsNaN(e) {
+			break
+		}
+		coeffs = append(coeffs, append([]float64(nil), lpc[:i+1]...))
+		errs = append(errs, e)
+	}
+	return coeffs, errs
+}
+
+// quantize converts coefficients to integers of prec bits and the shift that
+// scales them back down. ok is false if the coefficients are too large to be
+// represented with a non-negative shift.
+func quantize(c []float64, prec uint) (q []int64, shift int, ok bool) {
+	var cmax float64
+	for _, v := range c {
+		cmax = math.Max(cmax, math.Abs(v))
+	}
+	if cmax == 0 {
+		return nil, 0, false
+	}
+
+	_, exp := math.Frexp(cmax) // cmax < 2^exp
+	shift = int(prec) - 1 - exp
+	switch {
+	case shift > 15:
+		shift = 15
+	case shift < 0:
+		return nil, 0, false
+	}
+
+	qmax := int64(1)<<(prec-1) - 1
+	q = make([]int64, len(c))
+	var carry float64
+	for i, v := range c {
+		carry += v * float64(int64(1)<<uint(shift))
+		qi := int64(math.Round(carry))
+		if qi > qmax {
+			qi = qmax
+		} else if qi < -qmax-1 {
+			qi = -qmax - 1
+		}
+		q[i] = qi
+		carry -= float64(qi)
+	}
+	return q, shift, true
+}
+
+// lpcPrecision returns the precision, in bits, of the quantized LPC
+// coefficients for a block of n samples of bps bits, following the reference
+// encoder.
+func lpcPrecision(n int, bps uint) uint {
+	switch {
+	case bps < 16:
+		if p := 2 + bps/2; p > 5 {
+			return p
+		}
+		return 5
+	case bps == 16:
+		switch {
+		case n <= 192:
+			return 7
+		case n <= 384:
+			return 8
+		case n <= 576:
+			return 9
+		case n <= 1152:
+			return 10
+		case n <= 2304:
+			return 11
+		case n <= 4608:
+			return 12
+		}
+		return 13
+	case n <= 384:
+		return 13
+	case n <= 1152:
+		return 14
+	}
+	return 15
+}
+
+// bestLPCOrder estimates the order whose residual codes in the fewest bits,
+// from the prediction error energies errs of a block of n samples.
+func bestLPCOrder(errs []float64, n int, bps, prec uint) int {
+	best, bestBits := 1, math.Inf(1)
+	for i, e := range errs {
+		order := i + 1
+		perSample := 0.0
+		if e > 0 {
+			perSample = math.Max(0, 0.5*math.Log2(e/float64(n)))
+		}
+		bits := perSample*float64(n-order) + float64(order)*float64(bps+prec)
+		if bits < bestBits {
+			best, bestBits = order, bits
+		}
+	}
+	return best
+}
@@ -0,0 +1,200 @@
+// picture.go - Building PICTURE blocks from image files.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"unicode/utf8"
+)
+
+// Picture types that a FLAC stream may hold at most one of.
+const (
+	PictureFileIcon      = 1
+	PictureOtherFileIcon = 2
+)
+
+// NewPicture returns a PictureBlock of type pictureType, one of the values of
+// PictureTypes, holding the PNG, JPEG, GIF or WebP image data, like metaflac
+// --import-picture-from. The MIME type, width, height, color depth in bits
+// per pixel and, for an image with a palette, number of colors are read from
+// the image. As the format requires, the description must be UTF-8 and a
+// "File Icon" must be a 32x32 PNG image.
+func NewPicture(pictureType, description string, data []byte) (*PictureBlock, error) {
+	typ, err := PictureTypeID(pictureType)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.ValidString(description) {
+		return nil, fmt.Errorf("picture description %q is not valid UTF-8", description)
+	}
+
+	blk := &PictureBlock{
+		PictureType: pictureType,
+		Description: description,
+		Length:      uint32(len(data)),
+		PictureBlob: data,
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		err = pngInfo(blk, data)
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		err = imageInfo(blk, "image/jpeg", data, jpeg.DecodeConfig)
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		err = imageInfo(blk, "image/gif", data, gif.DecodeConfig)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		err = webpInfo(blk, data)
+	default:
+		err = fmt.Errorf("picture is not a PNG, JPEG, GIF or WebP image")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if typ == PictureFileIcon && (blk.MimeType != "image/png" || blk.Width != 32 || blk.Height != 32) {
+		return nil, fmt.Errorf("%q picture must be a 32x32 PNG image, not a %dx%d %s image",
+			pictureType, blk.Width, blk.Height, blk.MimeType)
+	}
+	return blk, nil
+}
+
+// imageInfo fills in the MIME type, size and colors of blk from the header of
+// the image data, read with decodeConfig.
+func imageInfo(blk *PictureBlock, mime string, data []byte, decodeConfig func(r io.Reader) (image.Config, error)) error {
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid %s picture: %v", mime, err)
+	}
+	blk.MimeType = mime
+	blk.Width, blk.Height = uint32(cfg.Width), uint32(cfg.Height)
+	switch m := cfg.ColorModel.(type) {
+	case color.Palette:
+		// Palette entries are 8 bit RGB triples.
+		blk.ColorDepth, blk.NumColors = 24, uint32(len(m))
+	default:
+		switch m {
+		case color.GrayModel:
+			blk.ColorDepth = 8
+		case color.Gray16Model:
+			blk.ColorDepth = 16
+		case color.CMYKModel:
+			blk.ColorDepth = 32
+		default:
+			blk.ColorDepth = 24
+		}
+	}
+	return nil
+}
+
+// pngInfo fills in the MIME type, size and colors of blk from the PNG image
+// data. The color depth comes from the image header, which tells apart the
+// RGB and gray images with and without alpha that the image package does not.
+func pngInfo(blk *PictureBlock, data []byte) error {
+	if err := imageInfo(blk, "image/png", data, png.DecodeConfig); err != nil {
+		return err
+	}
+	// http://www.w3.org/TR/PNG/#11IHDR
+	// The IHDR chunk, which DecodeConfig has checked comes first, has the
+	// bit depth and color type at offsets 24 and 25.
+	depth := uint32(data[24])
+	switch data[25] {
+	case 0: // Gray
+		blk.ColorDepth = depth
+	case 2: // RGB
+		blk.ColorDepth = 3 * depth
+	case 4: // Gray and alpha
+		blk.ColorDepth = 2 * depth
+	case 6: // RGB and alpha
+		blk.ColorDepth = 4 * depth
+	}
+	return nil
+}
+
+// webpInfo fills in the MIME type, size and colors of blk from the WebP image
+// data, which the image package cannot read.
+func webpInfo(blk *PictureBlock, data []byte) error {
+	// https://developers.google.com/speed/webp/docs/riff_container
+	// The RIFF header is followed by a VP8 (lossy), VP8L (lossless) or VP8X
+	// (extended) chunk, with an 8 byte chunk header.
+	invalid := fmt.Errorf("invalid image/webp picture")
+	if len(data) < 30 {
+		return invalid
+	}
+	chunk := data[20:]
+	le24 := func(b []byte) uint32 {
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	}
+	blk.ColorDepth = 24
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// A 3 byte frame tag, a start code and 14 bit dimensions.
+		if !bytes.Equal(chunk[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return invalid
+		}
+		blk.Width = uint32(binary.LittleEndian.Uint16(chunk[6:])) & 0x3FFF
+		blk.Height = uint32(binary.LittleEndian.Uint16(chunk[8:])) & 0x3FFF
+	case "VP8L":
+		// A signature byte, then the dimensions less one in 14 bits each
+		// and an alpha flag.
+		if chunk[0] != 0x2F {
+			return invalid
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:])
+		blk.Width = bits&0x3FFF + 1
+		blk.Height = bits>>14&0x3FFF + 1
+		if bits>>28&1 == 1 {
+			blk.ColorDepth = 32
+		}
+	case "VP8X":
+		// Flags, 3 reserved bytes, then the canvas dimensions less one in
+		// 24 bits each.
+		blk.Width = le24(chunk[4:]) + 1
+		blk.Height = le24(chunk[7:]) + 1
+		if chunk[0]&0x10 != 0 {
+			blk.ColorDepth = 32
+		}
+	default:
+		return invalid
+	}
+	blk.MimeType = "image/webp"
+	return nil
+}
+
+// AddPicture adds blk to the pictures of m, and to m.Blocks if it is in use,
+// before any unknown and PADDING blocks. A stream may hold only one picture
+// of each of the "File Icon" and "Other File Icon" types.
+func (m *Metadata) AddPicture(blk *PictureBlock) error {
+	typ, err := PictureTypeID(blk.PictureType)
+	if err != nil {
+		return err
+	}
+	if typ == PictureFileIcon || typ == PictureOtherFileIcon {
+		for _, p := range m.Pictures {
+			if p.Data.PictureType == blk.PictureType {
+				return fmt.Errorf("stream already has a %q picture", blk.PictureType)
+			}
+		}
+	}
+	p := &Picture{Data: blk, IsPopulated: true}
+	m.Pictures = append(m.Pictures, p)
+	m.insertBlock(p)
+	return nil
+}
@@ -0,0 +1,135 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestNewPicture(t *testing.T) {
+	// The picture in testdata/silence-44-s.flac, written by metaflac.
+	pixel, err := hex.DecodeString(`89504e470d0a1a0a0000000d4948445200000001000000010802000000907753de000000097048597300000b1300000b1301009a9c180000000774494d4507d60b1c0a360608443d320000001d74455874436f6d6d656e7400437265617465642077697468205468652047494d50ef64256e0000000c4944415408d763f8ffff3f0005fe02fedccc59e70000000049454e44ae426082`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewPicture("Cover (front)", "A pixel.", pixel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PictureBlock{
+		PictureType: "Cover (front)",
+		MimeType:    "image/png",
+		Description: "A pixel.",
+		Width:       1,
+		Height:      1,
+		ColorDepth:  24,
+		Length:      150,
+		PictureBlob: pixel,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	rect := image.Rect(0, 0, 40, 30)
+	palette := color.Palette{color.Black, color.White, color.RGBA{255, 0, 0, 255}}
+	encode := func(enc func(*bytes.Buffer) error) []byte {
+		buf := new(bytes.Buffer)
+		if err := enc(buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	webp := func(chunk string, body ...byte) []byte {
+		b := append([]byte("RIFF\x00\x00\x00\x00WEBP"+chunk+"\x00\x00\x00\x00"), body...)
+		return append(b, make([]byte, 16)...)
+	}
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		mime   string
+		depth  uint32
+		colors uint32
+		width  uint32
+	}{
+		{"png rgba", encode(func(b *bytes.Buffer) error { return png.Encode(b, image.NewNRGBA(rect)) }), "image/png", 32, 0, 40},
+		{"png gray", encode(func(b *bytes.Buffer) error { return png.Encode(b, image.NewGray(rect)) }), "image/png", 8, 0, 40},
+		{"png gray16", encode(func(b *bytes.Buffer) error { return png.Encode(b, image.NewGray16(rect)) }), "image/png", 16, 0, 40},
+		{"png paletted", encode(func(b *bytes.Buffer) error { return png.Encode(b, image.NewPaletted(rect, palette)) }), "image/png", 24, 3, 40},
+		{"jpeg", encode(func(b *bytes.Buffer) error { return jpeg.Encode(b, image.NewRGBA(rect), nil) }), "image/jpeg", 24, 0, 40},
+		{"jpeg gray", encode(func(b *bytes.Buffer) error { return jpeg.Encode(b, image.NewGray(rect), nil) }), "image/jpeg", 8, 0, 40},
+		{"gif", encode(func(b *bytes.Buffer) error { return gif.Encode(b, image.NewPaletted(rect, palette), nil) }), "image/gif", 24, 4, 40},
+		{"webp lossy", webp("VP8 ", 0, 0, 0, 0x9D, 0x01, 0x2A, 40, 0, 30, 0), "image/webp", 24, 0, 40},
+		{"webp lossless", webp("VP8L", 0x2F, 0x27, 0x40, 0x07, 0x10), "image/webp", 32, 0, 40},
+		{"webp extended", webp("VP8X", 0, 0, 0, 0, 39, 0, 0, 29, 0, 0), "image/webp", 24, 0, 40},
+	} {
+		got, err := NewPicture("Cover (back)", "", tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.MimeType != tt.mime || got.Width != tt.width || got.Height != 30 || got.ColorDepth != tt.depth || got.NumColors != tt.colors {
+			t.Errorf("%s: got %s %dx%d, depth %d, %d colors", tt.name, got.MimeType, got.Width, got.Height, got.ColorDepth, got.NumColors)
+		}
+	}
+}
+
+func TestNewPictureErrors(t *testing.T) {
+	icon := func(size int) []byte {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, size, size))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	if _, err := NewPicture("File Icon", "", icon(32)); err != nil {
+		t.Errorf("32x32 PNG file icon: %v", err)
+	}
+	if _, err := NewPicture("File Icon", "", icon(16)); err == nil {
+		t.Error("NewPicture accepted a 16x16 file icon")
+	}
+	if _, err := NewPicture("Other File Icon", "", icon(16)); err != nil {
+		t.Errorf("16x16 other file icon: %v", err)
+	}
+	if _, err := NewPicture("Cover", "", icon(32)); err == nil {
+		t.Error("NewPicture accepted an unknown picture type")
+	}
+	if _, err := NewPicture("Other", "\xff", icon(32)); err == nil {
+		t.Error("NewPicture accepted a description that is not UTF-8")
+	}
+	if _, err := NewPicture("Other", "", []byte("BM not supported")); err == nil {
+		t.Error("NewPicture accepted a BMP image")
+	}
+	if _, err := NewPicture("Other", "", icon(32)[:30]); err == nil {
+		t.Error("NewPicture accepted a truncated PNG image")
+	}
+	if _, err := NewPicture("Other", "", []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")); err == nil {
+		t.Error("NewPicture accepted a truncated WebP image")
+	}
+}
+
+func TestAddPicture(t *testing.T) {
+	si, pad := &Streaminfo{IsPopulated: true}, &Padding{IsPopulated: true}
+	m := &Metadata{Blocks: []Block{si, pad}}
+	blk := &PictureBlock{PictureType: "File Icon", MimeType: "image/png", PictureBlob: []byte{1}}
+	if err := m.AddPicture(blk); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Pictures) != 1 || !reflect.DeepEqual(m.Blocks, []Block{si, m.Pictures[0], pad}) {
+		t.Errorf("Blocks = %v", m.Blocks)
+	}
+	if err := m.AddPicture(blk); err == nil {
+		t.Error("AddPicture accepted a second file icon")
+	}
+	if err := m.AddPicture(&PictureBlock{PictureType: "Cover (front)"}); err != nil {
+		t.Error(err)
+	}
+	if len(m.Pictures) != 2 || len(m.Blocks) != 4 || m.Blocks[3] != pad {
+		t.Errorf("Blocks = %v", m.Blocks)
+	}
+}
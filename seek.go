@@ -0,0 +1,162 @@
+// seek.go - Sample-accurate seeking in FLAC streams.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// defaultMaxFrameSize bounds the size of a frame when STREAMINFO does not.
+const defaultMaxFrameSize = 1 << 16
+
+// Seek positions the decoder so that the next frame returned by Next starts
+// exactly at sample, counting from 0: its FirstSample is sample, and its
+// Samples start with that sample. Seek narrows down the frame holding sample
+// with the SEEKTABLE passed to Open, if any, and then by bisection on frame
+// headers, and decodes the frames from there. Seek needs the reader passed to
+// NewDecoder to be an io.ReadSeeker.
+func (d *Decoder) Seek(sample uint64) error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.rs == nil {
+		return fmt.Errorf("stream does not support seeking")
+	}
+	if d.si.TotalSamples != 0 && sample >= d.si.TotalSamples {
+		return fmt.Errorf("sample %d is beyond the end of the stream at %d", sample, d.si.TotalSamples)
+	}
+	end, err := d.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	end -= d.base
+
+	// Seek points give the offsets of frames before and after sample.
+	lo, hi := int64(0), end
+	for _, p := range d.seekpoints {
+		if p.IsPlaceholder() || p.Offset >= uint64(end) {
+			continue
+		}
+		if off := int64(p.Offset); p.SampleNumber <= sample && off > lo {
+			lo = off
+		} else if p.SampleNumber > sample && off < hi {
+			hi = off
+		}
+	}
+
+	err = d.seekBetween(sample, lo, hi)
+	if err == errOvershot && lo > 0 {
+		// The seek points are wrong; start over without them.
+		err = d.seekBetween(sample, 0, end)
+	}
+	if err == errOvershot || err == io.EOF {
+		return fmt.Errorf("no frame holds sample %d", sample)
+	}
+	return err
+}
+
+// errOvershot means that decoding from the start of a seek found only frames
+// after the sample sought.
+var errOvershot = errors.New("seek overshot the sample")
+
+// seekBetween seeks to sample, which must be in a frame that starts at or
+// after offset lo and before offset hi.
+func (d *Decoder) seekBetween(sample uint64, lo, hi int64) error {
+	maxFrame := int64(d.si.MaxFrameSize)
+	if maxFrame == 0 {
+		maxFrame = defaultMaxFrameSize
+	}
+
+	// Bisect until decoding the rest of the way is cheap. lo is always the
+	// offset of a frame that starts at or before sample.
+	for hi-lo > 2*maxFrame {
+		mid := lo + (hi-lo)/2
+		h, off, err := d.headerAfter(mid)
+		switch {
+		case err == io.EOF, err == nil && h.FirstSample(d.si) > sample:
+			hi = mid
+		case err != nil:
+			return err
+		default:
+			lo = off
+		}
+	}
+
+	if err := d.reset(lo); err != nil {
+		return err
+	}
+	for {
+		frame, err := d.Next()
+		if err != nil {
+			if !isFrameError(err) {
+				return err
+			}
+			if _, err := d.resync(); err != nil {
+				return err
+			}
+			continue
+		}
+		first := frame.FirstSample
+		if first > sample {
+			return errOvershot
+		}
+		if n := uint64(frame.Header.BlockSize); sample < first+n {
+			frame.Samples = frame.Samples[int(sample-first)*int(frame.Header.Channels):]
+			frame.FirstSample = sample
+			frame.body = nil
+			d.pending = frame
+			return nil
+		}
+	}
+}
+
+// headerAfter returns the header of the first frame at or after offset off
+// and the offset where it starts. A sync code in the audio data can look like
+// a frame header, so a frame counts only if it decodes and passes its CRC-16;
+// the search carries on after one that does not.
+func (d *Decoder) headerAfter(off int64) (*FrameHeader, int64, error) {
+	if err := d.reset(off); err != nil {
+		return nil, 0, err
+	}
+	for {
+		if _, err := d.resync(); err != nil {
+			return nil, 0, err
+		}
+		start := d.br.n
+		frame, err := d.Next()
+		if err == nil {
+			return frame.Header, start, nil
+		}
+		if !isFrameError(err) {
+			return nil, 0, err
+		}
+		if err := d.reset(start + 1); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// reset positions the decoder at offset off from the first frame.
+func (d *Decoder) reset(off int64) error {
+	if _, err := d.rs.Seek(d.base+off, io.SeekStart); err != nil {
+		return err
+	}
+	d.r.Reset(d.rs)
+	d.br.align()
+	d.br.n = off
+	d.pending = nil
+	return nil
+}
@@ -0,0 +1,154 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// checkSeek seeks to each of targets in the stream b and checks that the
+// samples from there on match all, the stream's fully decoded samples.
+func checkSeek(t *testing.T, b []byte, all []int32, targets []uint64) {
+	t.Helper()
+	m, d, err := Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := uint64(m.Streaminfo.Data.Channels)
+	for _, target := range targets {
+		if err := d.Seek(target); err != nil {
+			t.Fatalf("Seek(%d): %v", target, err)
+		}
+		// Check the rest of the frame sought to and the frame after it.
+		want := all[target*ch:]
+		for i := 0; i < 2 && len(want) > 0; i++ {
+			frame, err := d.Next()
+			if err != nil {
+				t.Fatalf("Seek(%d): frame %d: %v", target, i, err)
+			}
+			if wantFirst := uint64(len(all)-len(want)) / ch; frame.FirstSample != wantFirst {
+				t.Fatalf("Seek(%d): frame %d starts at %d, want %d", target, i, frame.FirstSample, wantFirst)
+			}
+			if !reflect.DeepEqual(frame.Samples, want[:len(frame.Samples)]) {
+				t.Fatalf("Seek(%d): frame %d samples differ", target, i)
+			}
+			want = want[len(frame.Samples):]
+		}
+	}
+}
+
+func TestSeekSeektable(t *testing.T) {
+	for _, name := range []string{"testdata/44100-16-mono.flac", "testdata/silence-44-s.flac"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, all := decodeSamples(t, b)
+		if !m.Seektable.IsPopulated {
+			t.Fatalf("%s has no SEEKTABLE", name)
+		}
+		total := m.Streaminfo.Data.TotalSamples
+		bs := uint64(m.Streaminfo.Data.MaxBlockSize)
+		checkSeek(t, b, all, []uint64{total / 2, 0, 1, bs - 1, bs, bs + 1, total - 1, total / 3})
+	}
+}
+
+func TestSeekBisection(t *testing.T) {
+	samples := testSignal(44100*10, 2, 16)
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	b := encodeFile(t, si, &EncoderOptions{Level: 1, BlockSize: 576}, samples)
+
+	total := uint64(len(samples) / 2)
+	targets := []uint64{0, total - 1, 576, 575, 577}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		targets = append(targets, uint64(rng.Int63n(int64(total))))
+	}
+	checkSeek(t, b, samples, targets)
+}
+
+func TestSeekBadSeektable(t *testing.T) {
+	samples := testSignal(44100*3, 1, 16)
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	b := encodeFile(t, si, nil, samples)
+
+	_, d, err := Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A seek point that claims a late frame holds an early sample.
+	d.seekpoints = []*SeekpointBlock{{SampleNumber: 0, Offset: uint64(len(b) / 2)}}
+	if err := d.Seek(100); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := d.Next(); err != nil || frame.FirstSample != 100 || frame.Samples[0] != samples[100] {
+		t.Errorf("after Seek(100): got %+v, %v", frame, err)
+	}
+}
+
+func TestSeekErrors(t *testing.T) {
+	b, err := os.ReadFile("testdata/44100-16-mono.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, d, err := Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Seek(m.Streaminfo.Data.TotalSamples); err == nil {
+		t.Error("Seek past the end succeeded")
+	}
+
+	// A reader that cannot seek.
+	_, d, err = Open(io.MultiReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Seek(0); err == nil {
+		t.Error("Seek succeeded on a reader that cannot seek")
+	}
+
+	// A Decoder without a STREAMINFO.
+	_, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	d = NewDecoder(bytes.NewReader(audio), nil)
+	if err := d.Seek(0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Seek without STREAMINFO: got %v, want ErrInvalidValue", err)
+	}
+}
+
+func TestSeekFalseSync(t *testing.T) {
+	// Noise, which is stored verbatim, with the header of frame 0 near the
+	// end of every frame: a sync code in the audio data that parses as a
+	// frame header but is not the start of a frame.
+	const bs, frames = 576, 200
+	hdr, err := (&FrameHeader{BlockSize: bs, SampleRate: 44100, Channels: 1, BitsPerSample: 16}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hdr)%2 != 0 {
+		hdr = append(hdr, 0x5A)
+	}
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int32, bs*frames)
+	for i := range samples {
+		samples[i] = int32(int16(rng.Uint32()))
+	}
+	for f := 0; f < frames; f++ {
+		s := samples[f*bs+bs-2-len(hdr)/2:]
+		for i := 0; i < len(hdr); i += 2 {
+			s[i/2] = int32(int16(hdr[i])<<8 | int16(hdr[i+1]))
+		}
+	}
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	b := encodeFile(t, si, &EncoderOptions{BlockSize: bs}, samples)
+	if n := bytes.Count(b, hdr); n < frames/2 {
+		t.Fatalf("only %d false sync codes in the stream", n)
+	}
+
+	targets := []uint64{bs*frames/2 + 7, bs*frames*3/4 + 300, 5, bs*frames - 1}
+	checkSeek(t, b, samples, targets)
+}
@@ -0,0 +1,151 @@
+// seektable.go - Building and validating SEEKTABLEs.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// BuildSeektable decodes the audio frames read from r, which must be
+// positioned at the first frame, and returns a seek point for every interval
+// samples, like metaflac --add-seekpoint=#x. Each seek point refers to the
+// frame holding its target sample, so targets that fall in the same frame
+// share a point; the points are sorted by sample number and unique, as the
+// format requires.
+func BuildSeektable(r io.Reader, si *StreaminfoBlock, interval uint64) ([]*SeekpointBlock, error) {
+	if interval == 0 {
+		return nil, fmt.Errorf("seek point interval must be at least 1 sample")
+	}
+
+	sp := &seekpoints{interval: interval}
+	d := NewDecoder(r, si)
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			return sp.points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sp.add(frame.FirstSample, frame.Offset, int(frame.Header.BlockSize))
+	}
+}
+
+// seekpoints collects the seek points for every interval samples from the
+// frames of a stream, in order.
+type seekpoints struct {
+	interval uint64
+	target   uint64 // Sample of the next seek point.
+	points   []*SeekpointBlock
+}
+
+// add adds a seek point for the frame of n samples from sample first, at
+// offset off, if the frame holds the next target.
+func (sp *seekpoints) add(first uint64, off int64, n int) {
+	if first+uint64(n) <= sp.target {
+		return
+	}
+	sp.points = append(sp.points, &SeekpointBlock{
+		SampleNumber: first,
+		Offset:       uint64(off),
+		FrameSamples: uint16(n),
+	})
+	// Skip the targets this frame holds.
+	sp.target += (first + uint64(n) - sp.target + sp.interval - 1) / sp.interval * sp.interval
+}
+
+// seekInterval returns the number of samples in d of audio at the sample
+// rate of si.
+func seekInterval(si *StreaminfoBlock, d time.Duration) (uint64, error) {
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid seek point interval %v", d)
+	}
+	rate := uint64(si.SampleRate)
+	interval := uint64(d/time.Second)*rate + uint64(d%time.Second)*rate/uint64(time.Second)
+	if interval == 0 {
+		return 0, fmt.Errorf("seek point interval %v is shorter than a sample", d)
+	}
+	return interval, nil
+}
+
+// BuildSeektableEvery is like BuildSeektable, with seek points every d of
+// audio, like metaflac --add-seekpoint=#s.
+func BuildSeektableEvery(r io.Reader, si *StreaminfoBlock, d time.Duration) ([]*SeekpointBlock, error) {
+	interval, err := seekInterval(si, d)
+	if err != nil {
+		return nil, err
+	}
+	return BuildSeektable(r, si, interval)
+}
+
+// SetSeektable stores points as the SEEKTABLE of m. If m.Blocks is set and
+// has no SEEKTABLE yet, one is added after the STREAMINFO and APPLICATION
+// blocks.
+func (m *Metadata) SetSeektable(points []*SeekpointBlock) {
+	m.Seektable.Data = points
+	m.Seektable.IsPopulated = true
+	m.setBlock(&m.Seektable)
+}
+
+// SeekpointError describes a seek point that breaks the SEEKTABLE rules.
+type SeekpointError struct {
+	Index  int // Index of the point in the Seektable's Data.
+	Point  *SeekpointBlock
+	Reason string
+}
+
+func (e *SeekpointError) Error() string {
+	return fmt.Sprintf("seek point %d (sample %d): %s", e.Index, e.Point.SampleNumber, e.Reason)
+}
+
+// SeektableErrors lists every seek point that breaks the SEEKTABLE rules.
+type SeektableErrors []*SeekpointError
+
+func (e SeektableErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks that the seek points are sorted in ascending order and
+// unique by sample number, and that any placeholder points come last. It
+// returns nil or a SeektableErrors listing every offending point.
+func (s *Seektable) Validate() error {
+	var errs SeektableErrors
+	var prev *SeekpointBlock
+	placeholders := false
+	for i, sp := range s.Data {
+		switch {
+		case sp.IsPlaceholder():
+			placeholders = true
+			continue
+		case placeholders:
+			errs = append(errs, &SeekpointError{i, sp, "follows a placeholder point"})
+		case prev != nil && sp.SampleNumber == prev.SampleNumber:
+			errs = append(errs, &SeekpointError{i, sp, "duplicates the previous point's sample number"})
+		case prev != nil && sp.SampleNumber < prev.SampleNumber:
+			errs = append(errs, &SeekpointError{i, sp, fmt.Sprintf("is before the previous point's sample %d", prev.SampleNumber)})
+		}
+		prev = sp
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
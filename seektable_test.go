@@ -0,0 +1,178 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildSeektableMatchesReference(t *testing.T) {
+	// The reference encoder wrote this file's SEEKTABLE with a point every
+	// 10 seconds.
+	m, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	got, err := BuildSeektableEvery(bytes.NewReader(audio), m.Streaminfo.Data, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m.Seektable.Data) {
+		t.Errorf("got seek points %v, want %v", got, m.Seektable.Data)
+	}
+
+	for _, d := range []time.Duration{0, -time.Second, time.Microsecond} {
+		if _, err := BuildSeektableEvery(bytes.NewReader(audio), m.Streaminfo.Data, d); err == nil {
+			t.Errorf("BuildSeektableEvery accepted interval %v", d)
+		}
+	}
+}
+
+func TestBuildSeektable(t *testing.T) {
+	samples := testSignal(44100*5, 1, 16)
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 1, BitsPerSample: 16}
+	b := encodeFile(t, si, &EncoderOptions{BlockSize: 4096}, samples)
+
+	r := bytes.NewReader(b)
+	m := new(Metadata)
+	if err := m.Read(r); err != nil {
+		t.Fatal(err)
+	}
+	audio := b[len(b)-r.Len():]
+
+	// Every 3000 samples: several targets fall in some frames, none in others.
+	points, err := BuildSeektable(bytes.NewReader(audio), m.Streaminfo.Data, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []uint64
+	for target := uint64(0); target < uint64(len(samples)); target += 3000 {
+		if first := target / 4096 * 4096; len(want) == 0 || want[len(want)-1] != first {
+			want = append(want, first)
+		}
+	}
+	var got []uint64
+	for _, p := range points {
+		got = append(got, p.SampleNumber)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("seek point samples = %v, want %v", got, want)
+	}
+
+	// Every point must lead to the frame it names.
+	d := NewDecoder(bytes.NewReader(audio), m.Streaminfo.Data)
+	for _, p := range points {
+		frame, err := d.Next()
+		for err == nil && frame.FirstSample < p.SampleNumber {
+			frame, err = d.Next()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(frame.Offset) != p.Offset || uint16(frame.Header.BlockSize) != p.FrameSamples {
+			t.Errorf("seek point %+v, frame at offset %d has %d samples", p, frame.Offset, frame.Header.BlockSize)
+		}
+	}
+
+	if _, err := BuildSeektable(bytes.NewReader(audio), m.Streaminfo.Data, 0); err == nil {
+		t.Error("BuildSeektable accepted an interval of 0")
+	}
+}
+
+func TestSetSeektable(t *testing.T) {
+	samples := testSignal(44100*3, 2, 16)
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	b := encodeFile(t, si, nil, samples)
+
+	r := bytes.NewReader(b)
+	m := new(Metadata)
+	if err := m.Read(r); err != nil {
+		t.Fatal(err)
+	}
+	audio := b[len(b)-r.Len():]
+	m.VorbisComment = VorbisComment{Data: &VorbisCommentBlock{Vendor: "test"}, IsPopulated: true}
+	m.Blocks = append(m.Blocks, &m.VorbisComment)
+
+	points, err := BuildSeektableEvery(bytes.NewReader(audio), m.Streaminfo.Data, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSeektable(points)
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(audio)
+
+	got := new(Metadata)
+	if err := got.Read(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Seektable.Data, points) {
+		t.Errorf("SEEKTABLE = %v, want %v", got.Seektable.Data, points)
+	}
+	if typ := got.Blocks[1].BlockHeader().Type; typ != MetadataSeektable {
+		t.Errorf("second block is %s, want %s", typ, MetadataSeektable)
+	}
+	checkSeek(t, buf.Bytes(), samples, []uint64{44100 + 5, 2 * 44100, 10})
+
+	// Setting it again replaces the table rather than adding another.
+	m.SetSeektable(points[:1])
+	if n := len(m.Blocks); n != 3 {
+		t.Errorf("got %d blocks after replacing the SEEKTABLE, want 3", n)
+	}
+}
+
+func TestSeektableValidate(t *testing.T) {
+	placeholder := func() *SeekpointBlock { return &SeekpointBlock{SampleNumber: SeekpointPlaceholder} }
+	point := func(n uint64) *SeekpointBlock { return &SeekpointBlock{SampleNumber: n, Offset: n, FrameSamples: 4096} }
+
+	st := &Seektable{Data: []*SeekpointBlock{point(0), point(4096), placeholder(), placeholder()}}
+	if err := st.Validate(); err != nil {
+		t.Errorf("valid table: %v", err)
+	}
+	if points, placeholders := st.TotalPoints(); points != 2 || placeholders != 2 {
+		t.Errorf("TotalPoints = %d, %d; want 2, 2", points, placeholders)
+	}
+	if !st.Data[2].IsPlaceholder() || st.Data[0].IsPlaceholder() {
+		t.Error("IsPlaceholder misidentifies points")
+	}
+
+	st = &Seektable{Data: []*SeekpointBlock{
+		point(4096), point(0), point(8192), point(8192), placeholder(), point(12288),
+	}}
+	err := st.Validate()
+	errs, ok := err.(SeektableErrors)
+	if !ok {
+		t.Fatalf("got %v, want SeektableErrors", err)
+	}
+	var indexes []int
+	for _, e := range errs {
+		indexes = append(indexes, e.Index)
+	}
+	if want := []int{1, 3, 5}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("errors for points %v, want %v: %v", indexes, want, err)
+	}
+}
+
+func TestReadStrictSeektable(t *testing.T) {
+	m, audio := openAudio(t, "testdata/44100-16-mono.flac")
+	m.Seektable.Data[0], m.Seektable.Data[1] = m.Seektable.Data[1], m.Seektable.Data[0]
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(audio)
+
+	got := new(Metadata)
+	var errs SeektableErrors
+	if !errors.As(got.ReadStrict(bytes.NewReader(buf.Bytes())), &errs) {
+		t.Error("ReadStrict accepted unsorted seek points")
+	}
+	if len(got.Seektable.Data) != 3 {
+		t.Error("unsorted seek points not kept")
+	}
+	if err := new(Metadata).Read(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("Read rejected unsorted seek points: %v", err)
+	}
+}
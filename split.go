@@ -0,0 +1,301 @@
+// split.go - Splitting CD images into one FLAC stream per track.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PregapMode says what Split does with the pregap of each track: the audio
+// from its INDEX 00 to its INDEX 01.
+type PregapMode int
+
+const (
+	// PregapAppend appends each pregap to the previous track, as most CD
+	// rippers do. Audio before the first track's INDEX 01, such as a
+	// hidden track, is left out.
+	PregapAppend PregapMode = iota
+
+	// PregapPrepend keeps each pregap at the start of its own track. Audio
+	// before the first track goes with the first track.
+	PregapPrepend
+
+	// PregapDiscard leaves pregaps out.
+	PregapDiscard
+)
+
+// SplitOptions are the options for Split. The zero value appends pregaps to
+// the previous track and re-encodes at DefaultCompressionLevel.
+type SplitOptions struct {
+	Pregap PregapMode
+
+	// Encoder gives the compression level of re-encoded frames; its
+	// BlockSize is ignored. nil means DefaultCompressionLevel.
+	Encoder *EncoderOptions
+}
+
+// trackRange is the part of a stream that Split writes for a track.
+type trackRange struct {
+	track      *CuesheetTrack
+	start, end uint64
+}
+
+// splitRanges returns the part of the stream that goes in each track.
+func (blk *CuesheetBlock) splitRanges(mode PregapMode) ([]trackRange, error) {
+	if len(blk.Tracks) < 2 {
+		return nil, fmt.Errorf("cue sheet has no tracks")
+	}
+	tracks := blk.Tracks[:len(blk.Tracks)-1]
+
+	// Each track has audio from its first index point, and from INDEX 01.
+	first := make([]uint64, len(tracks)+1)
+	index01 := make([]uint64, len(tracks)+1)
+	for i, t := range tracks {
+		if len(t.Indexes) == 0 {
+			return nil, fmt.Errorf("track %d has no index points", t.Number)
+		}
+		first[i] = t.Offset + t.Indexes[0].SampleOffset
+		index01[i] = first[i]
+		for _, idx := range t.Indexes {
+			if idx.IndexPoint == 1 {
+				index01[i] = t.Offset + idx.SampleOffset
+			}
+		}
+	}
+	leadout := blk.Tracks[len(blk.Tracks)-1].Offset
+	first[len(tracks)], index01[len(tracks)] = leadout, leadout
+
+	ranges := make([]trackRange, len(tracks))
+	for i, t := range tracks {
+		r := trackRange{t, index01[i], index01[i+1]}
+		switch mode {
+		case PregapPrepend:
+			r.start, r.end = first[i], first[i+1]
+			if i == 0 {
+				r.start = 0
+			}
+		case PregapDiscard:
+			r.end = first[i+1]
+		}
+		if r.start >= r.end || i > 0 && r.start < ranges[i-1].end {
+			return nil, fmt.Errorf("track %d is out of order", t.Number)
+		}
+		ranges[i] = r
+	}
+	return ranges, nil
+}
+
+// splitComments returns the Vorbis comments of the image vc for track t of
+// n. Comments whose field names end in the track's number in brackets, such
+// as TITLE[2], replace the field for that track; those for other tracks are
+// left out. The image's TITLE becomes the ALBUM, if there is none. The
+// TRACKNUMBER and ISRC are those of the cue sheet, and TRACKTOTAL is set if
+// not given.
+func splitComments(vc *VorbisCommentBlock, t *CuesheetTrack, n int) *VorbisCommentBlock {
+	out := &VorbisCommentBlock{Vendor: vc.Vendor}
+	tracks := make(map[string][]string)
+	var fields []string
+	for _, c := range vc.Comments {
+		field, value, ok := splitComment(c)
+		if ok && strings.HasSuffix(field, "]") {
+			if i := strings.LastIndexByte(field, '['); i > 0 {
+				if num, err := strconv.Atoi(field[i+1 : len(field)-1]); err == nil {
+					if num == int(t.Number) {
+						field = upperFieldName(field[:i])
+						if tracks[field] == nil {
+							fields = append(fields, field)
+						}
+						tracks[field] = append(tracks[field], value)
+					}
+					continue
+				}
+			}
+		}
+		if !hasField(c, "CUESHEET") {
+			out.Comments = append(out.Comments, c)
+		}
+	}
+
+	if title := out.Get("TITLE"); title != nil {
+		if out.Get("ALBUM") == nil {
+			out.Set("ALBUM", title...)
+		}
+		out.Delete("TITLE")
+	}
+	for _, field := range fields {
+		out.Set(field, tracks[field]...)
+	}
+	out.Set("TRACKNUMBER", strconv.Itoa(int(t.Number)))
+	if out.Get("TRACKTOTAL") == nil {
+		out.Set("TRACKTOTAL", strconv.Itoa(n))
+	}
+	if isrc := trimNUL(t.ISRC); isrc != "" {
+		out.Set("ISRC", isrc)
+	}
+	return out
+}
+
+// Split cuts the FLAC stream read from r, such as a CD image, into one FLAC
+// stream per track of its CUESHEET. create is called with each track and the
+// metadata for it, which it may change, and returns the writer for the
+// track, which Split closes once the track is written. Each track has the
+// image's STREAMINFO values, pictures and Vorbis comments. Comments whose
+// field names end in a track number in brackets, such as TITLE[2], give the
+// field for that track only; the image's TITLE becomes the ALBUM, if there is
+// none; and TRACKNUMBER, TRACKTOTAL and ISRC are filled in from the cue
+// sheet.
+//
+// The frames within a track are copied without being encoded again; only
+// the frames cut by track boundaries are. A track that starts on a frame
+// boundary of a stream of fixed block size keeps the fixed block size;
+// other tracks are streams of variable block size. As with an Encoder, the
+// STREAMINFO of a track is only complete if its writer is an io.WriteSeeker.
+func Split(r io.Reader, opts *SplitOptions, create func(t *CuesheetTrack, m *Metadata) (io.WriteCloser, error)) error {
+	if opts == nil {
+		opts = new(SplitOptions)
+	}
+	m, d, err := Open(r)
+	if err != nil {
+		return err
+	}
+	if !m.Cuesheet.IsPopulated {
+		return fmt.Errorf("stream has no CUESHEET")
+	}
+	ranges, err := m.Cuesheet.Data.splitRanges(opts.Pregap)
+	if err != nil {
+		return err
+	}
+	si := m.Streaminfo.Data
+	d.br.keep = true
+
+	encOpts := EncoderOptions{Level: DefaultCompressionLevel, BlockSize: int(si.MaxBlockSize)}
+	if opts.Encoder != nil {
+		encOpts.Level = opts.Encoder.Level
+	}
+	fixed := si.MinBlockSize == si.MaxBlockSize
+
+	var (
+		w   io.WriteCloser
+		enc *Encoder
+	)
+	open := func(tr trackRange, variable bool) error {
+		tm := &Metadata{
+			Streaminfo: Streaminfo{Data: &StreaminfoBlock{
+				SampleRate:    si.SampleRate,
+				Channels:      si.Channels,
+				BitsPerSample: si.BitsPerSample,
+			}},
+			Pictures: m.Pictures,
+		}
+		if m.VorbisComment.IsPopulated {
+			tm.VorbisComment = VorbisComment{Data: splitComments(m.VorbisComment.Data, tr.track, len(ranges)), IsPopulated: true}
+		}
+		var err error
+		if w, err = create(tr.track, tm); err != nil {
+			return err
+		}
+		enc, err = newEncoder(w, tm, &encOpts, variable)
+		return err
+	}
+	finish := func() error {
+		err := enc.Close()
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		w, enc = nil, nil
+		return err
+	}
+	defer func() {
+		if w != nil {
+			w.Close()
+		}
+	}()
+
+	t := 0
+	ch := uint64(si.Channels)
+	for t < len(ranges) {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		fs := frame.FirstSample
+		fe := fs + uint64(frame.Header.BlockSize)
+		for t < len(ranges) {
+			tr := ranges[t]
+			if fe <= tr.start {
+				break
+			}
+			if enc == nil {
+				if err := open(tr, !fixed || frame.Header.VariableBlockSize || fs != tr.start); err != nil {
+					return err
+				}
+			}
+
+			lo, hi := fs, fe
+			if lo < tr.start {
+				lo = tr.start
+			}
+			if hi > tr.end {
+				hi = tr.end
+			}
+			if lo == fs && hi == fe {
+				err = enc.copyFrame(frame)
+			} else {
+				err = enc.Write(frame.Samples[(lo-fs)*ch : (hi-fs)*ch])
+			}
+			if err != nil {
+				return err
+			}
+			if hi < tr.end {
+				break
+			}
+			if err := finish(); err != nil {
+				return err
+			}
+			t++
+		}
+	}
+	if t < len(ranges) {
+		return fmt.Errorf("stream ends before the end of track %d", ranges[t].track.Number)
+	}
+	return nil
+}
+
+// SplitFile splits the FLAC file at path like Split, writing the tracks to
+// files named after their track numbers, such as 01.flac, in dir. It returns
+// the names of the files written.
+func SplitFile(path, dir string, opts *SplitOptions) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	err = Split(f, opts, func(t *CuesheetTrack, m *Metadata) (io.WriteCloser, error) {
+		name := filepath.Join(dir, fmt.Sprintf("%02d.flac", t.Number))
+		names = append(names, name)
+		return os.Create(name)
+	})
+	return names, err
+}
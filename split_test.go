@@ -0,0 +1,227 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeImage encodes samples with the cue sheet cs and comments to a file in
+// dir and returns its name.
+func writeImage(t *testing.T, dir string, si StreaminfoBlock, samples []int32, cs *CuesheetBlock, comments ...string) string {
+	t.Helper()
+	name := filepath.Join(dir, "image.flac")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := &Metadata{Streaminfo: Streaminfo{Data: &si}}
+	m.SetCuesheet(cs)
+	if comments != nil {
+		m.VorbisComment = VorbisComment{Data: &VorbisCommentBlock{Vendor: "test", Comments: comments}, IsPopulated: true}
+	}
+	enc, err := NewEncoder(f, m, &EncoderOptions{BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Write(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestSplit(t *testing.T) {
+	const frame = CDSamplesPerFrame
+	si := StreaminfoBlock{SampleRate: 44100, Channels: 2, BitsPerSample: 16}
+	samples := testSignal(300*frame, 2, 16)
+	cs := &CuesheetBlock{
+		LeadinSamples: 88200,
+		IsCompactDisc: true,
+		Tracks: []*CuesheetTrack{
+			{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 10 * frame, IndexPoint: 1}}},
+			{Offset: 100 * frame, Number: 2, ISRC: "USABC1234567", Indexes: []*TrackIndex{{IndexPoint: 0}, {SampleOffset: 20 * frame, IndexPoint: 1}}},
+			{Offset: 200 * frame, Number: 3, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+			{Offset: 300 * frame, Number: CDLeadoutTrack},
+		},
+	}
+	dir := t.TempDir()
+	image := writeImage(t, dir, si, samples, cs, "TITLE=Album", "ARTIST=Someone", "TITLE[2]=Second", "ARTIST[3]=Guest", "CUESHEET=...")
+
+	for _, tt := range []struct {
+		mode   PregapMode
+		bounds [][2]int
+	}{
+		{PregapAppend, [][2]int{{10 * frame, 120 * frame}, {120 * frame, 200 * frame}, {200 * frame, 300 * frame}}},
+		{PregapPrepend, [][2]int{{0, 100 * frame}, {100 * frame, 200 * frame}, {200 * frame, 300 * frame}}},
+		{PregapDiscard, [][2]int{{10 * frame, 100 * frame}, {120 * frame, 200 * frame}, {200 * frame, 300 * frame}}},
+	} {
+		out := t.TempDir()
+		names, err := SplitFile(image, out, &SplitOptions{Pregap: tt.mode})
+		if err != nil {
+			t.Fatalf("mode %d: %v", tt.mode, err)
+		}
+		if len(names) != 3 {
+			t.Fatalf("mode %d: got %d files", tt.mode, len(names))
+		}
+		for i, name := range names {
+			b, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Verify(bytes.NewReader(b)); err != nil {
+				t.Errorf("mode %d track %d: Verify: %v", tt.mode, i+1, err)
+			}
+			m, got := decodeSamples(t, b)
+			want := samples[2*tt.bounds[i][0] : 2*tt.bounds[i][1]]
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("mode %d track %d: got %d samples, want %d", tt.mode, i+1, len(got)/2, len(want)/2)
+			}
+			if n := m.Streaminfo.Data.TotalSamples; n != uint64(len(want)/2) {
+				t.Errorf("mode %d track %d: TotalSamples = %d", tt.mode, i+1, n)
+			}
+		}
+	}
+
+	// Check the comments, and that only track 1 keeps the fixed block size
+	// when pregaps are prepended, with its frames copied as they are.
+	out := t.TempDir()
+	names, err := SplitFile(image, out, &SplitOptions{Pregap: PregapPrepend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]string{
+		{"ARTIST=Someone", "ALBUM=Album", "TRACKNUMBER=1", "TRACKTOTAL=3"},
+		{"ARTIST=Someone", "ALBUM=Album", "TITLE=Second", "TRACKNUMBER=2", "TRACKTOTAL=3", "ISRC=USABC1234567"},
+		{"ARTIST=Guest", "ALBUM=Album", "TRACKNUMBER=3", "TRACKTOTAL=3"},
+	} {
+		f, err := os.Open(names[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, d, err := Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.VorbisComment.Data.Comments; !reflect.DeepEqual(got, want) {
+			t.Errorf("track %d comments = %q, want %q", i+1, got, want)
+		}
+		frame, err := d.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Header.VariableBlockSize != (i > 0) {
+			t.Errorf("track %d VariableBlockSize = %v", i+1, frame.Header.VariableBlockSize)
+		}
+		f.Close()
+	}
+
+	src, err := os.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcStart, dstStart := audioStart(t, src), audioStart(t, dst)
+	if n := 8192; !bytes.Equal(src[srcStart:srcStart+n], dst[dstStart:dstStart+n]) {
+		t.Error("frames of track 1 were not copied as they are")
+	}
+}
+
+// audioStart returns the offset of the first frame of the FLAC stream b.
+func audioStart(t *testing.T, b []byte) int {
+	t.Helper()
+	r := bytes.NewReader(b)
+	if err := new(Metadata).Read(r); err != nil {
+		t.Fatal(err)
+	}
+	return len(b) - r.Len()
+}
+
+func TestSplitShortHead(t *testing.T) {
+	// A track starting 7 samples before a frame boundary, which is too
+	// short for a frame of its own, in a stream that is not CD audio.
+	si := StreaminfoBlock{SampleRate: 48000, Channels: 1, BitsPerSample: 24}
+	samples := testSignal(40000, 1, 24)
+	cs := &CuesheetBlock{Tracks: []*CuesheetTrack{
+		{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		{Offset: 5*4096 - 7, Number: 2, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		{Offset: 40000, Number: LeadoutTrack},
+	}}
+	image := writeImage(t, t.TempDir(), si, samples, cs)
+
+	var bufs []*bytes.Buffer
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	err = Split(f, nil, func(track *CuesheetTrack, m *Metadata) (io.WriteCloser, error) {
+		if m.VorbisComment.IsPopulated {
+			t.Error("track has Vorbis comments that the image does not")
+		}
+		bufs = append(bufs, new(bytes.Buffer))
+		return nopCloser{bufs[len(bufs)-1]}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bufs) != 2 {
+		t.Fatalf("got %d tracks", len(bufs))
+	}
+	_, got := decodeSamples(t, bufs[1].Bytes())
+	if !reflect.DeepEqual(got, samples[5*4096-7:]) {
+		t.Error("track 2 samples differ")
+	}
+	d := NewDecoder(bytes.NewReader(bufs[1].Bytes()[audioStart(t, bufs[1].Bytes()):]), &StreaminfoBlock{})
+	frame, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Header.BlockSize != 4096+7 {
+		t.Errorf("first frame has %d samples, want %d", frame.Header.BlockSize, 4096+7)
+	}
+}
+
+// nopCloser adds a Close method that does nothing to a writer.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func TestSplitErrors(t *testing.T) {
+	if _, err := SplitFile("testdata/44100-16-mono.flac", t.TempDir(), nil); err == nil {
+		t.Error("SplitFile accepted a stream without a CUESHEET")
+	}
+
+	cs := &CuesheetBlock{Tracks: []*CuesheetTrack{
+		{Number: 1, Indexes: []*TrackIndex{{IndexPoint: 1}}},
+		{Offset: 50000, Number: LeadoutTrack},
+	}}
+	si := StreaminfoBlock{SampleRate: 48000, Channels: 1, BitsPerSample: 16}
+	image := writeImage(t, t.TempDir(), si, testSignal(40000, 1, 16), cs)
+	if _, err := SplitFile(image, t.TempDir(), nil); err == nil {
+		t.Error("SplitFile accepted a cue sheet longer than the stream")
+	}
+
+	err := Split(bytes.NewReader(noStreaminfo(t)), nil, func(*CuesheetTrack, *Metadata) (io.WriteCloser, error) {
+		t.Fatal("Split created a track of a stream without STREAMINFO")
+		return nil, nil
+	})
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("stream without STREAMINFO: got %v, want ErrInvalidValue", err)
+	}
+}
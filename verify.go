@@ -0,0 +1,174 @@
+// verify.go - Integrity checking of FLAC audio.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// unsetMD5 is the MD5Signature of a stream whose encoder did not compute one.
+var unsetMD5 = strings.Repeat("0", 2*md5.Size)
+
+// FrameError describes an audio frame that failed to decode or verify.
+type FrameError struct {
+	Frame  uint64 // Index of the frame in the stream, counting from 0.
+	Offset int64  // Byte offset of the frame from the start of the stream.
+	Err    error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame %d at offset %d: %v", e.Frame, e.Offset, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// MD5Error means the MD5 of the decoded samples differs from the STREAMINFO
+// MD5 signature.
+type MD5Error struct {
+	Want, Got string
+}
+
+func (e *MD5Error) Error() string {
+	return fmt.Sprintf("MD5 signature mismatch: STREAMINFO has %s, audio has %s", e.Want, e.Got)
+}
+
+// VerifyErrors lists every integrity failure found by Verify.
+type VerifyErrors []error
+
+func (e VerifyErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// appendSamples appends samples to b in the byte layout that the STREAMINFO
+// MD5 signature is computed over: interleaved, signed little-endian, with
+// each sample taking the fewest whole bytes that hold bps bits.
+func appendSamples(b []byte, samples []int32, bps uint8) []byte {
+	width := (int(bps) + 7) / 8
+	for _, s := range samples {
+		for i := 0; i < width; i++ {
+			b = append(b, byte(s>>(8*i)))
+		}
+	}
+	return b
+}
+
+// Verify decodes the whole FLAC stream read from r, like flac -t. It checks
+// the CRC-16 of every frame, that every frame agrees with STREAMINFO, that
+// the number of samples matches STREAMINFO and, unless the encoder left it
+// unset, that the MD5 of the decoded samples matches the MD5 signature.
+//
+// Integrity failures are returned together as a VerifyErrors, whose entries
+// are *FrameError, *MD5Error or errors about the sample count; decoding
+// carries on past a damaged frame at the next frame header. Any other error,
+// such as unreadable metadata or a missing STREAMINFO, is returned as is.
+func Verify(r io.Reader) error {
+	cr := &countingReader{r: r}
+	m := new(Metadata)
+	if err := m.Read(cr); err != nil {
+		return err
+	}
+	si, err := m.streaminfo()
+	if err != nil {
+		return err
+	}
+	start := cr.n
+
+	var errs VerifyErrors
+	sum := md5.New()
+	d := NewDecoder(r, si)
+	var buf []byte
+	var samples uint64
+	for i := uint64(0); ; i++ {
+		frame, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !isFrameError(err) {
+				return err
+			}
+			errs = append(errs, &FrameError{Frame: i, Offset: start + d.start, Err: err})
+			if frame == nil {
+				if _, err := d.resync(); err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+				continue
+			}
+		} else if err := frame.Header.Check(si); err != nil {
+			errs = append(errs, &FrameError{Frame: i, Offset: start + frame.Offset, Err: err})
+		}
+
+		buf = appendSamples(buf[:0], frame.Samples, frame.Header.BitsPerSample)
+		sum.Write(buf)
+		samples += uint64(frame.Header.BlockSize)
+	}
+
+	if si.TotalSamples != 0 && samples != si.TotalSamples {
+		errs = append(errs, fmt.Errorf("decoded %d samples, STREAMINFO has %d", samples, si.TotalSamples))
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); si.MD5Signature != unsetMD5 && got != si.MD5Signature {
+		errs = append(errs, &MD5Error{Want: si.MD5Signature, Got: got})
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// VerifyFile runs Verify on the FLAC file at path.
+func VerifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Verify(f)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// isFrameError reports whether err describes damaged audio frames rather
+// than a failure to read them.
+func isFrameError(err error) bool {
+	for _, target := range []error{ErrTruncated, ErrInvalidValue, ErrLostSync, ErrChecksum} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	for _, name := range []string{"testdata/44100-16-mono.flac", "testdata/silence-44-s.flac"} {
+		if err := VerifyFile(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestVerifyDamaged(t *testing.T) {
+	const name = "testdata/44100-16-mono.flac"
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, audio := openAudio(t, name)
+	start := len(raw) - len(audio)
+
+	// Find the offsets of frames 5 and 6, then damage the middle of frame 5.
+	var offsets []int64
+	d := NewDecoder(bytes.NewReader(audio), m.Streaminfo.Data)
+	for len(offsets) < 7 {
+		frame, err := d.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, frame.Offset)
+	}
+	damaged := append([]byte(nil), raw...)
+	damaged[start+int((offsets[5]+offsets[6])/2)] ^= 0x10
+
+	err = Verify(bytes.NewReader(damaged))
+	var errs VerifyErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want VerifyErrors", err)
+	}
+	var fe *FrameError
+	if !errors.As(errs[0], &fe) || fe.Frame != 5 || fe.Offset != int64(start)+offsets[5] {
+		t.Errorf("first error = %v, want an error in frame 5 at offset %d", errs[0], int64(start)+offsets[5])
+	}
+	var me *MD5Error
+	if !errors.As(errs[len(errs)-1], &me) {
+		t.Errorf("last error = %v, want an MD5 mismatch", errs[len(errs)-1])
+	}
+
+	// A truncated file is short of samples.
+	err = Verify(bytes.NewReader(raw[:start+int(offsets[6])]))
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Errorf("truncated file: got %v, want sample count and MD5 errors", err)
+	}
+}
+
+func TestVerifyNoStreaminfo(t *testing.T) {
+	if err := Verify(bytes.NewReader(noStreaminfo(t))); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+}
@@ -0,0 +1,232 @@
+// vorbis.go - Field access for Vorbis comments.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// http://www.xiph.org/vorbis/doc/v-comment.html
+// A comment is a "FIELD=value" pair. The field name is case-insensitive and
+// may consist of ASCII 0x20 through 0x7D, 0x3D ('=') excluded. A field may
+// occur any number of times; every occurrence is a separate value.
+
+// ValidFieldName reports whether name is a legal Vorbis comment field name.
+func ValidFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x20 || c > 0x7D || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitComment splits a comment into its field name and value. ok is false if
+// the comment contains no '='.
+func splitComment(c string) (field, value string, ok bool) {
+	i := strings.IndexByte(c, '=')
+	if i < 0 {
+		return "", "", false
+	}
+	return c[:i], c[i+1:], true
+}
+
+// upperASCII returns c upper-cased if it is an ASCII letter.
+func upperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// upperFieldName returns the field name f with its ASCII letters upper-cased.
+func upperFieldName(f string) string {
+	b := []byte(f)
+	for i, c := range b {
+		b[i] = upperASCII(c)
+	}
+	return string(b)
+}
+
+// equalFieldNames reports whether a and b are the same field name. Unlike
+// strings.EqualFold, it folds only ASCII letters, so that no other character
+// matches one, as the Kelvin sign does a K.
+func equalFieldNames(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if upperASCII(a[i]) != upperASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasField reports whether comment c is a value of field.
+func hasField(c, field string) bool {
+	f, _, ok := splitComment(c)
+	return ok && equalFieldNames(f, field)
+}
+
+// Get returns every value of field, in order of appearance. The field name is
+// matched case-insensitively.
+func (blk *VorbisCommentBlock) Get(field string) []string {
+	var values []string
+	for _, c := range blk.Comments {
+		if f, v, ok := splitComment(c); ok && equalFieldNames(f, field) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// First returns the first value of field, or "" if the field is not present.
+func (blk *VorbisCommentBlock) First(field string) string {
+	for _, c := range blk.Comments {
+		if f, v, ok := splitComment(c); ok && equalFieldNames(f, field) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Set replaces every value of field with values. The new values take the
+// place of the first existing value, or are appended if the field is not
+// present. Set with no values deletes the field.
+func (blk *VorbisCommentBlock) Set(field string, values ...string) error {
+	if !ValidFieldName(field) {
+		return fmt.Errorf("invalid Vorbis comment field name %q", field)
+	}
+
+	var comments []string
+	pos := -1
+	for _, c := range blk.Comments {
+		if hasField(c, field) {
+			if pos < 0 {
+				pos = len(comments)
+			}
+			continue
+		}
+		comments = append(comments, c)
+	}
+	if pos < 0 {
+		pos = len(comments)
+	}
+
+	added := make([]string, len(values))
+	for i, v := range values {
+		added[i] = field + "=" + v
+	}
+	blk.Comments = append(comments[:pos:pos], append(added, comments[pos:]...)...)
+	blk.TotalComments = uint32(len(blk.Comments))
+	return nil
+}
+
+// Add appends a value to field, keeping any existing values.
+func (blk *VorbisCommentBlock) Add(field, value string) error {
+	if !ValidFieldName(field) {
+		return fmt.Errorf("invalid Vorbis comment field name %q", field)
+	}
+	blk.Comments = append(blk.Comments, field+"="+value)
+	blk.TotalComments = uint32(len(blk.Comments))
+	return nil
+}
+
+// Delete removes every value of field.
+func (blk *VorbisCommentBlock) Delete(field string) {
+	var comments []string
+	for _, c := range blk.Comments {
+		if !hasField(c, field) {
+			comments = append(comments, c)
+		}
+	}
+	blk.Comments = comments
+	blk.TotalComments = uint32(len(blk.Comments))
+}
+
+// Fields returns the distinct field names present, with their ASCII letters
+// upper-cased, in order of first appearance. Comments without an '=' are
+// ignored.
+func (blk *VorbisCommentBlock) Fields() []string {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, c := range blk.Comments {
+		f, _, ok := splitComment(c)
+		if !ok {
+			continue
+		}
+		f = upperFieldName(f)
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// VorbisCommentError describes a malformed Vorbis comment.
+type VorbisCommentError struct {
+	Index   int // Index of the comment in Comments, or -1 for the vendor string.
+	Comment string
+	Reason  string
+}
+
+func (e *VorbisCommentError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("malformed Vorbis comment vendor string %q: %s", e.Comment, e.Reason)
+	}
+	return fmt.Sprintf("malformed Vorbis comment %d %q: %s", e.Index, e.Comment, e.Reason)
+}
+
+// VorbisCommentErrors lists every malformed comment in a VorbisCommentBlock.
+type VorbisCommentErrors []*VorbisCommentError
+
+func (e VorbisCommentErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks that the vendor string is valid UTF-8 and that every comment
+// is a legal field name, an '=' and a valid UTF-8 value. It returns nil or a
+// VorbisCommentErrors listing every malformed comment.
+func (blk *VorbisCommentBlock) Validate() error {
+	var errs VorbisCommentErrors
+	if !utf8.ValidString(blk.Vendor) {
+		errs = append(errs, &VorbisCommentError{-1, blk.Vendor, "invalid UTF-8"})
+	}
+	for i, c := range blk.Comments {
+		f, v, ok := splitComment(c)
+		switch {
+		case !ok:
+			errs = append(errs, &VorbisCommentError{i, c, "missing '=' separator"})
+		case !ValidFieldName(f):
+			errs = append(errs, &VorbisCommentError{i, c, fmt.Sprintf("invalid field name %q", f)})
+		case !utf8.ValidString(v):
+			errs = append(errs, &VorbisCommentError{i, c, "value is not valid UTF-8"})
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
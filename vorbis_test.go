@@ -0,0 +1,166 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newTestComments() *VorbisCommentBlock {
+	return &VorbisCommentBlock{
+		Vendor:        "test",
+		TotalComments: 5,
+		Comments: []string{
+			"album=Quod Libet Test Data",
+			"artist=piman",
+			"ARTIST=jzig",
+			"title=Silence",
+			"no separator",
+		},
+	}
+}
+
+func TestVorbisCommentGet(t *testing.T) {
+	blk := newTestComments()
+
+	if got, want := blk.Get("Artist"), []string{"piman", "jzig"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get(Artist) = %q, want %q", got, want)
+	}
+	if got := blk.Get("genre"); got != nil {
+		t.Errorf("Get(genre) = %q, want nil", got)
+	}
+	if got, want := blk.First("ARTIST"), "piman"; got != want {
+		t.Errorf("First(ARTIST) = %q, want %q", got, want)
+	}
+	if got := blk.First("genre"); got != "" {
+		t.Errorf("First(genre) = %q, want empty", got)
+	}
+	if got, want := blk.Fields(), []string{"ALBUM", "ARTIST", "TITLE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %q, want %q", got, want)
+	}
+}
+
+func TestVorbisCommentFieldNamesASCII(t *testing.T) {
+	// The Kelvin sign and the long s fold to k and s in Unicode, but field
+	// names are case-insensitive in ASCII only.
+	blk := &VorbisCommentBlock{Comments: []string{"\u212aEY=C", "ARTI\u017fT=x", "key=D"}}
+	if got, want := blk.Get("KEY"), []string{"D"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get(KEY) = %q, want %q", got, want)
+	}
+	if got := blk.First("artist"); got != "" {
+		t.Errorf("First(artist) = %q, want empty", got)
+	}
+	if got, want := blk.Fields(), []string{"\u212aEY", "ARTI\u017fT", "KEY"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %q, want %q", got, want)
+	}
+	blk.Delete("key")
+	if want := []string{"\u212aEY=C", "ARTI\u017fT=x"}; !reflect.DeepEqual(blk.Comments, want) {
+		t.Errorf("after Delete(key): Comments = %q, want %q", blk.Comments, want)
+	}
+}
+
+func TestVorbisCommentSet(t *testing.T) {
+	blk := newTestComments()
+
+	if err := blk.Set("ARTIST", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"album=Quod Libet Test Data",
+		"ARTIST=a",
+		"ARTIST=b",
+		"title=Silence",
+		"no separator",
+	}
+	if !reflect.DeepEqual(blk.Comments, want) {
+		t.Errorf("Comments = %q, want %q", blk.Comments, want)
+	}
+
+	if err := blk.Set("GENRE", "Silence"); err != nil {
+		t.Fatal(err)
+	}
+	if got := blk.Comments[len(blk.Comments)-1]; got != "GENRE=Silence" {
+		t.Errorf("new field not appended: %q", blk.Comments)
+	}
+	if err := blk.Add("genre", "Noise"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := blk.Get("Genre"), []string{"Silence", "Noise"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get(Genre) = %q, want %q", got, want)
+	}
+
+	blk.Delete("artist")
+	if got := blk.Get("artist"); got != nil {
+		t.Errorf("Get(artist) after Delete = %q", got)
+	}
+	if got, want := blk.TotalComments, uint32(len(blk.Comments)); got != want || got != 5 {
+		t.Errorf("TotalComments = %d, want %d (5 comments)", got, want)
+	}
+
+	for _, field := range []string{"", "A=B", "TITLE\x7e", "TÍTLE"} {
+		if err := blk.Set(field, "x"); err == nil {
+			t.Errorf("Set(%q) accepted an invalid field name", field)
+		}
+		if err := blk.Add(field, "x"); err == nil {
+			t.Errorf("Add(%q) accepted an invalid field name", field)
+		}
+	}
+}
+
+func TestVorbisCommentValidate(t *testing.T) {
+	if err := (&VorbisCommentBlock{Vendor: "v", Comments: []string{"TITLE=Šilence", "A B=c"}}).Validate(); err != nil {
+		t.Errorf("Validate of valid comments: %v", err)
+	}
+
+	blk := &VorbisCommentBlock{
+		Vendor: "bad\xff",
+		Comments: []string{
+			"ARTIST=ok",
+			"no separator",
+			"=empty field",
+			"TÍTLE=bad field",
+			"TITLE=bad \xc3 value",
+		},
+	}
+	err := blk.Validate()
+	errs, ok := err.(VorbisCommentErrors)
+	if !ok {
+		t.Fatalf("Validate returned %T %v, want VorbisCommentErrors", err, err)
+	}
+	var idx []int
+	for _, e := range errs {
+		idx = append(idx, e.Index)
+	}
+	if want := []int{-1, 1, 2, 3, 4}; !reflect.DeepEqual(idx, want) {
+		t.Errorf("malformed comment indexes = %v, want %v", idx, want)
+	}
+}
+
+func TestReadStrict(t *testing.T) {
+	raw, err := os.ReadFile("testdata/44100-16-mono.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Metadata).ReadStrict(bytes.NewReader(raw)); err != nil {
+		t.Errorf("ReadStrict of valid file: %v", err)
+	}
+
+	// Replace the '=' in "ARTIST=GoGoGo".
+	i := bytes.Index(raw, []byte("ARTIST=GoGoGo"))
+	raw[i+len("ARTIST")] = ':'
+
+	m := new(Metadata)
+	err = m.ReadStrict(bytes.NewReader(raw))
+	var errs VorbisCommentErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Index != 0 {
+		t.Errorf("ReadStrict returned %v, want a single error for comment 0", err)
+	}
+	if got := m.VorbisComment.Data.Comments; len(got) != 1 || got[0] != "ARTIST:GoGoGo" {
+		t.Errorf("malformed comment not kept: %q", got)
+	}
+	if err := new(Metadata).Read(bytes.NewReader(raw)); err != nil {
+		t.Errorf("Read rejected malformed comment: %v", err)
+	}
+}
@@ -0,0 +1,424 @@
+// write.go - Serialization of FLAC metadata.
+// Copyright (C) 2012 Matthew White <mtw@vne.net>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or (at
+// your option) any later version.
+//
+// This program is distributed in the hope that it will be useful, but
+// WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+// or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+// for more details.
+
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// padString returns s right-padded with NUL bytes to n bytes, or an error if
+// s does not fit.
+func padString(s string, n int, field string) ([]byte, error) {
+	if len(s) > n {
+		return nil, fmt.Errorf("%s %q is longer than %d bytes", field, s, n)
+	}
+	b := make([]byte, n)
+	copy(b, s)
+	return b, nil
+}
+
+// Bytes returns the 4 byte encoding of the MetadataBlockHeader.
+func (h *MetadataBlockHeader) Bytes() ([]byte, error) {
+	if h.Type >= MetadataInvalid {
+		return nil, fmt.Errorf("invalid block type: %d", h.Type)
+	}
+	if h.Length >= 1<<24 {
+		return nil, fmt.Errorf("%s block length %d does not fit in 24 bits", h.Type, h.Length)
+	}
+
+	bits := uint32(h.Type)<<24 | h.Length
+	if h.Last {
+		bits |= 1 << 31
+	}
+
+	b := make([]byte, MetadataBlockHeaderLen/8)
+	binary.BigEndian.PutUint32(b, bits)
+	return b, nil
+}
+
+// Bytes returns the binary encoding of the ApplicationBlock.
+func (blk *ApplicationBlock) Bytes() ([]byte, error) {
+	b := make([]byte, ApplicationIdLen/8, ApplicationIdLen/8+len(blk.Data))
+	binary.BigEndian.PutUint32(b, blk.Id)
+	return append(b, blk.Data...), nil
+}
+
+// Bytes returns the binary encoding of the CuesheetBlock. The number of
+// tracks and track indexes written is taken from the Tracks and Indexes
+// slices rather than the TotalTracks and IndexPoints fields.
+func (blk *CuesheetBlock) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	mcn, err := padString(blk.MediaCatalogNumber, CuesheetMediaCatalogNumberLen/8, "media catalog number")
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(mcn)
+	binary.Write(buf, binary.BigEndian, blk.LeadinSamples)
+
+	res := make([]byte, CuesheetReservedLen/8)
+	copy(res, blk.reserved)
+	if blk.IsCompactDisc {
+		res[0] |= 1 << 7
+	}
+	buf.Write(res)
+
+	if len(blk.Tracks) == 0 || len(blk.Tracks) > 255 {
+		return nil, fmt.Errorf("invalid number of cuesheet tracks %d; must be between 1 and 255", len(blk.Tracks))
+	}
+	buf.WriteByte(uint8(len(blk.Tracks)))
+
+	for _, track := range blk.Tracks {
+		binary.Write(buf, binary.BigEndian, track.Offset)
+		buf.WriteByte(track.Number)
+
+		isrc, err := padString(track.ISRC, CuesheetTrackTrackISRCLen/8, "track ISRC")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(isrc)
+
+		res := make([]byte, CuesheetTrackReservedLen/8)
+		copy(res, track.reserved)
+		res[0] |= (track.Type & 0x01) << 7
+		if track.PreEmphasis {
+			res[0] |= 1 << 6
+		}
+		buf.Write(res)
+
+		if len(track.Indexes) > 255 {
+			return nil, fmt.Errorf("too many index points (%d) in cuesheet track %d", len(track.Indexes), track.Number)
+		}
+		buf.WriteByte(uint8(len(track.Indexes)))
+
+		for _, index := range track.Indexes {
+			binary.Write(buf, binary.BigEndian, index.SampleOffset)
+			buf.WriteByte(index.IndexPoint)
+			res := make([]byte, CuesheetTrackIndexReservedLen/8)
+			copy(res, index.reserved)
+			buf.Write(res)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Bytes returns the binary encoding of the PictureBlock. The picture data
+// length is taken from PictureBlob rather than the Length field. A picture
+// type that was read as "UNKNOWN" is written back with its original id.
+func (blk *PictureBlock) Bytes() ([]byte, error) {
+	typ, err := PictureTypeID(blk.PictureType)
+	if err != nil {
+		if blk.PictureType != PictureType(blk.typeID) {
+			return nil, err
+		}
+		typ = blk.typeID
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, typ)
+	binary.Write(buf, binary.BigEndian, uint32(len(blk.MimeType)))
+	buf.WriteString(blk.MimeType)
+	binary.Write(buf, binary.BigEndian, uint32(len(blk.Description)))
+	buf.WriteString(blk.Description)
+	binary.Write(buf, binary.BigEndian, blk.Width)
+	binary.Write(buf, binary.BigEndian, blk.Height)
+	binary.Write(buf, binary.BigEndian, blk.ColorDepth)
+	binary.Write(buf, binary.BigEndian, blk.NumColors)
+	binary.Write(buf, binary.BigEndian, uint32(len(blk.PictureBlob)))
+	buf.Write(blk.PictureBlob)
+	return buf.Bytes(), nil
+}
+
+// Bytes returns the binary encoding of the SeekpointBlock.
+func (blk *SeekpointBlock) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, blk)
+	return buf.Bytes(), nil
+}
+
+// Bytes returns the binary encoding of the StreaminfoBlock.
+func (blk *StreaminfoBlock) Bytes() ([]byte, error) {
+	switch {
+	case blk.MinFrameSize >= StreaminfoMaxFrameSizeMaximum || blk.MaxFrameSize >= StreaminfoMaxFrameSizeMaximum:
+		return nil, fmt.Errorf("invalid frame size range %d-%d; must be < %d", blk.MinFrameSize, blk.MaxFrameSize, StreaminfoMaxFrameSizeMaximum)
+	case blk.SampleRate == 0 || blk.SampleRate >= 655350:
+		return nil, fmt.Errorf("invalid SampleRate '%d'; must be > 0 and < 655350", blk.SampleRate)
+	case blk.Channels < StreaminfoChannelCountMinimum || blk.Channels > StreaminfoChannelCountMaximum:
+		return nil, fmt.Errorf("invalid Channels '%d'; must be between 1 and 8", blk.Channels)
+	case blk.BitsPerSample < StreaminfoBitsPerSampleMinimum || blk.BitsPerSample > 32:
+		return nil, fmt.Errorf("invalid BitsPerSample '%d'; must be between 4 and 32", blk.BitsPerSample)
+	case blk.TotalSamples >= StreaminfoTotalSamplesMaximum:
+		return nil, fmt.Errorf("invalid TotalSamples '%d'; must fit in 36 bits", blk.TotalSamples)
+	}
+
+	md5 := make([]byte, StreaminfoMD5Len/8)
+	if blk.MD5Signature != "" {
+		sig, err := hex.DecodeString(blk.MD5Signature)
+		if err != nil || len(sig) != len(md5) {
+			return nil, fmt.Errorf("invalid MD5Signature %q", blk.MD5Signature)
+		}
+		copy(md5, sig)
+	}
+
+	b := make([]byte, 0, 34)
+	b = append(b, byte(blk.MinBlockSize>>8), byte(blk.MinBlockSize))
+
+	bits := uint64(blk.MaxBlockSize)<<48 | uint64(blk.MinFrameSize)<<24 | uint64(blk.MaxFrameSize)
+	b = binary.BigEndian.AppendUint64(b, bits)
+
+	bits = uint64(blk.SampleRate)<<44 |
+		uint64(blk.Channels-1)<<41 |
+		uint64(blk.BitsPerSample-1)<<36 |
+		blk.TotalSamples
+	b = binary.BigEndian.AppendUint64(b, bits)
+
+	return append(b, md5...), nil
+}
+
+// Bytes returns the binary encoding of the VorbisCommentBlock. The number of
+// comments written is taken from the Comments slice rather than the
+// TotalComments field.
+func (blk *VorbisCommentBlock) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, uint32(len(blk.Vendor)))
+	buf.WriteString(blk.Vendor)
+	binary.Write(buf, binary.LittleEndian, uint32(len(blk.Comments)))
+	for _, c := range blk.Comments {
+		binary.Write(buf, binary.LittleEndian, uint32(len(c)))
+		buf.WriteString(c)
+	}
+	return buf.Bytes(), nil
+}
+
+// Bytes implements the Block interface.
+func (a *Application) Bytes() ([]byte, error) {
+	return a.Data.Bytes()
+}
+
+// Bytes implements the Block interface.
+func (c *Cuesheet) Bytes() ([]byte, error) {
+	return c.Data.Bytes()
+}
+
+// Bytes implements the Block interface. The padding is len(Data) zero bytes
+// or, if Data is nil, as many zero bytes as the header's Length.
+func (p *Padding) Bytes() ([]byte, error) {
+	n := len(p.Data)
+	if p.Data == nil && p.Header != nil {
+		n = int(p.Header.Length)
+	}
+	return make([]byte, n), nil
+}
+
+// Bytes implements the Block interface.
+func (p *Picture) Bytes() ([]byte, error) {
+	return p.Data.Bytes()
+}
+
+// Bytes implements the Block interface.
+func (s *Seektable) Bytes() ([]byte, error) {
+	var b []byte
+	for _, sp := range s.Data {
+		spb, err := sp.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, spb...)
+	}
+	return b, nil
+}
+
+// Bytes implements the Block interface.
+func (s *Streaminfo) Bytes() ([]byte, error) {
+	return s.Data.Bytes()
+}
+
+// Bytes implements the Block interface.
+func (u *Unknown) Bytes() ([]byte, error) {
+	return u.Data.Data, nil
+}
+
+// Bytes implements the Block interface.
+func (v *VorbisComment) Bytes() ([]byte, error) {
+	return v.Data.Bytes()
+}
+
+// encodedBlock is the binary encoding of a single metadata block, minus its header.
+type encodedBlock struct {
+	Type MetadataBlockType
+	Data []byte
+}
+
+// blockList returns m.Blocks or, if it is nil, every populated block in m in
+// the order in which the reference encoder writes them.
+func (m *Metadata) blockList() []Block {
+	if m.Blocks != nil {
+		return m.Blocks
+	}
+
+	var blocks []Block
+	if m.Streaminfo.IsPopulated {
+		blocks = append(blocks, &m.Streaminfo)
+	}
+	for _, a := range m.Applications {
+		blocks = append(blocks, a)
+	}
+	if m.Seektable.IsPopulated {
+		blocks = append(blocks, &m.Seektable)
+	}
+	if m.VorbisComment.IsPopulated {
+		blocks = append(blocks, &m.VorbisComment)
+	}
+	if m.Cuesheet.IsPopulated {
+		blocks = append(blocks, &m.Cuesheet)
+	}
+	for _, p := range m.Pictures {
+		blocks = append(blocks, p)
+	}
+	for _, u := range m.Unknowns {
+		blocks = append(blocks, u)
+	}
+	for _, p := range m.Paddings {
+		blocks = append(blocks, p)
+	}
+	return blocks
+}
+
+// canonicalRank orders block types as blockList does.
+func canonicalRank(t MetadataBlockType) int {
+	switch t {
+	case MetadataStreaminfo:
+		return 0
+	case MetadataApplication:
+		return 1
+	case MetadataSeektable:
+		return 2
+	case MetadataVorbisComment:
+		return 3
+	case MetadataCuesheet:
+		return 4
+	case MetadataPicture:
+		return 5
+	case MetadataPadding:
+		return 7
+	}
+	return 6
+}
+
+// setBlock puts blk, a block of which m holds at most one, in m.Blocks if it
+// is in use: in place of the existing block of its type, or else where
+// insertBlock puts it.
+func (m *Metadata) setBlock(blk Block) {
+	if m.Blocks == nil {
+		return
+	}
+	typ := blk.BlockHeader().Type
+	for i, b := range m.Blocks {
+		if b.BlockHeader().Type == typ {
+			m.Blocks[i] = blk
+			return
+		}
+	}
+	m.insertBlock(blk)
+}
+
+// insertBlock adds blk to m.Blocks, if it is in use, before the first block
+// that comes after it in the canonical order.
+func (m *Metadata) insertBlock(blk Block) {
+	if m.Blocks == nil {
+		return
+	}
+	rank := canonicalRank(blk.BlockHeader().Type)
+	i := 0
+	for i < len(m.Blocks) && canonicalRank(m.Blocks[i].BlockHeader().Type) <= rank {
+		i++
+	}
+	m.Blocks = append(m.Blocks[:i:i], append([]Block{blk}, m.Blocks[i:]...)...)
+}
+
+// encodeBlocks returns the binary encoding of the blocks to be written for m.
+func (m *Metadata) encodeBlocks() ([]*encodedBlock, error) {
+	var blocks []*encodedBlock
+	for i, blk := range m.blockList() {
+		t := blk.BlockHeader().Type
+		if (i == 0) != (t == MetadataStreaminfo) {
+			return nil, fmt.Errorf("%s must be the first and only block, found %s at position %d", MetadataStreaminfo, t, i)
+		}
+		b, err := blk.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s block: %v", t, err)
+		}
+		blocks = append(blocks, &encodedBlock{t, b})
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("missing %s block", MetadataStreaminfo)
+	}
+	return blocks, nil
+}
+
+// writeBlocks writes the FLAC signature followed by blocks to w, setting the
+// Last flag on the final block.
+func writeBlocks(w io.Writer, blocks []*encodedBlock) (int64, error) {
+	var total int64
+
+	n, err := io.WriteString(w, FlacSignature)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	for i, blk := range blocks {
+		hdr := &MetadataBlockHeader{
+			Type:   blk.Type,
+			Length: uint32(len(blk.Data)),
+			Last:   i == len(blocks)-1,
+		}
+		if len(blk.Data) >= 1<<24 {
+			return total, fmt.Errorf("%s block length %d does not fit in 24 bits", blk.Type, len(blk.Data))
+		}
+		h, err := hdr.Bytes()
+		if err != nil {
+			return total, err
+		}
+
+		n, err := w.Write(h)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		n, err = w.Write(blk.Data)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// WriteTo writes the FLAC signature and the metadata blocks of m to w: the
+// blocks listed in m.Blocks or, if it is nil, every populated block. Block
+// lengths and the Last flag are computed from the block contents; the Length
+// and Last fields of the existing headers are ignored. A Streaminfo block is
+// required and must come first.
+func (m *Metadata) WriteTo(w io.Writer) (int64, error) {
+	blocks, err := m.encodeBlocks()
+	if err != nil {
+		return 0, err
+	}
+	return writeBlocks(w, blocks)
+}
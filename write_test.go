@@ -0,0 +1,231 @@
+package flac
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// metadataLen returns the length of the signature and metadata blocks at the
+// start of a FLAC file.
+func metadataLen(t *testing.T, b []byte) int {
+	i := len(FlacSignature)
+	for {
+		hdr, err := MarshalMetadataBlockHeader(b[i:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		i += MetadataBlockHeaderLen/8 + int(hdr.Length)
+		if hdr.Last {
+			return i
+		}
+	}
+}
+
+func TestWriteToRoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/44100-16-mono.flac", "testdata/silence-44-s.flac"} {
+		raw, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := new(Metadata)
+		if err := m.Read(bytes.NewReader(raw)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		buf := new(bytes.Buffer)
+		n, err := m.WriteTo(buf)
+		if err != nil {
+			t.Fatalf("%s: WriteTo: %v", name, err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("%s: WriteTo returned %d, wrote %d bytes", name, n, buf.Len())
+		}
+
+		want := raw[:metadataLen(t, raw)]
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: written metadata differs from original", name)
+		}
+
+		got := new(Metadata)
+		if err := got.Read(buf); err != nil {
+			t.Fatalf("%s: re-reading written metadata: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("%s: metadata differs after round trip:\ngot:  %+v\nwant: %+v", name, got, m)
+		}
+	}
+}
+
+func TestWriteToRequiresStreaminfo(t *testing.T) {
+	m := &Metadata{VorbisComment: VorbisComment{
+		Data:        &VorbisCommentBlock{Vendor: "test"},
+		IsPopulated: true,
+	}}
+	if _, err := m.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("WriteTo succeeded without a STREAMINFO block")
+	}
+}
+
+func TestMetadataBlockHeaderBytes(t *testing.T) {
+	hdr := &MetadataBlockHeader{Type: MetadataPicture, Length: 0x123456, Last: true}
+	b, err := hdr.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x86, 0x12, 0x34, 0x56}; !bytes.Equal(b, want) {
+		t.Errorf("got %x, want %x", b, want)
+	}
+	got, err := MarshalMetadataBlockHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, hdr) {
+		t.Errorf("got %+v, want %+v", got, hdr)
+	}
+
+	if _, err := (&MetadataBlockHeader{Type: MetadataPadding, Length: 1 << 24}).Bytes(); err == nil {
+		t.Error("Bytes accepted a length that does not fit in 24 bits")
+	}
+}
+
+func TestWriteToBlockOrder(t *testing.T) {
+	f, err := os.Open("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := new(Metadata)
+	if err := m.Read(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move VORBIS_COMMENT straight after STREAMINFO and drop PADDING.
+	m.Blocks = []Block{&m.Streaminfo, &m.VorbisComment, &m.Seektable, &m.Cuesheet, m.Pictures[0]}
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Metadata)
+	if err := got.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	var types []MetadataBlockType
+	for _, blk := range got.Blocks {
+		types = append(types, blk.BlockHeader().Type)
+	}
+	want := []MetadataBlockType{MetadataStreaminfo, MetadataVorbisComment, MetadataSeektable, MetadataCuesheet, MetadataPicture}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("block order = %v, want %v", types, want)
+	}
+	if len(got.Paddings) != 0 {
+		t.Error("deleted PADDING block was written")
+	}
+	if !got.Pictures[0].BlockHeader().Last {
+		t.Error("Last flag not set on final block")
+	}
+
+	m.Blocks = []Block{&m.VorbisComment, &m.Streaminfo}
+	if _, err := m.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("WriteTo accepted a STREAMINFO block that is not first")
+	}
+}
+
+func TestWriteToMultipleApplicationsAndPaddings(t *testing.T) {
+	m := &Metadata{
+		Streaminfo: Streaminfo{
+			Data: &StreaminfoBlock{
+				MinBlockSize:  4096,
+				MaxBlockSize:  4096,
+				SampleRate:    44100,
+				Channels:      2,
+				BitsPerSample: 16,
+			},
+			IsPopulated: true,
+		},
+		Applications: []*Application{
+			{Data: &ApplicationBlock{Id: 0x666f6f62, Data: []byte("foo")}, IsPopulated: true},
+			{Data: &ApplicationBlock{Id: 0x62617221, Data: []byte("bar!")}, IsPopulated: true},
+		},
+		Paddings: []*Padding{
+			{Data: make([]byte, 10), IsPopulated: true},
+			{Data: make([]byte, 20), IsPopulated: true},
+		},
+	}
+	m.Blocks = []Block{&m.Streaminfo, m.Paddings[0], m.Applications[0], m.Applications[1], m.Paddings[1]}
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Metadata)
+	if err := got.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Applications) != 2 || len(got.Paddings) != 2 {
+		t.Fatalf("got %d APPLICATION and %d PADDING blocks, want 2 of each", len(got.Applications), len(got.Paddings))
+	}
+	for i, a := range got.Applications {
+		if !reflect.DeepEqual(a.Data, m.Applications[i].Data) {
+			t.Errorf("APPLICATION %d = %+v, want %+v", i, a.Data, m.Applications[i].Data)
+		}
+	}
+	for i, p := range got.Paddings {
+		if got, want := p.Header.Length, uint32(len(m.Paddings[i].Data)); got != want {
+			t.Errorf("PADDING %d length = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestWriteToUnknownPictureType(t *testing.T) {
+	raw, err := os.ReadFile("testdata/silence-44-s.flac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw = raw[:metadataLen(t, raw)]
+
+	// Give the picture the unassigned type 21.
+	for i := len(FlacSignature); ; {
+		hdr, err := MarshalMetadataBlockHeader(raw[i:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		i += MetadataBlockHeaderLen / 8
+		if hdr.Type == MetadataPicture {
+			copy(raw[i:], []byte{0, 0, 0, 21})
+			break
+		}
+		if hdr.Last {
+			t.Fatal("no PICTURE block in test file")
+		}
+		i += int(hdr.Length)
+	}
+
+	m := new(Metadata)
+	if err := m.Read(bytes.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Pictures[0].Data.PictureType; got != "UNKNOWN" {
+		t.Errorf("PictureType = %q, want %q", got, "UNKNOWN")
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("written metadata differs from original")
+	}
+
+	// A type name that was never read is still rejected.
+	m.Pictures[0].Data = &PictureBlock{PictureType: "UNKNOWN"}
+	if _, err := m.Pictures[0].Bytes(); err == nil {
+		t.Error("Bytes accepted an UNKNOWN picture type that was not read from a stream")
+	}
+}